@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 	"time"
 
 	xp "github.com/BurntSushi/xgb/xproto"
@@ -42,6 +43,7 @@ func doScreen(k *workspace, t1 interface{}) bool {
 	if !ok {
 		return false
 	}
+	screens := k.root.screens
 	i := -1
 	for j, s := range screens {
 		if s.workspace == k {
@@ -61,6 +63,58 @@ func doScreen(k *workspace, t1 interface{}) bool {
 	return true
 }
 
+// doScreenMigrate moves the focused frame's window to another screen's
+// workspace. The argument is a traversal for the next or previous screen, or an
+// int for the Nth screen.
+func doScreenMigrate(k *workspace, a interface{}) bool {
+	w := k.focusedFrame.window
+	if w == nil || k.screen == nil {
+		return true
+	}
+	screens := k.root.screens
+	i := -1
+	for j, s := range screens {
+		if s == k.screen {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		return true
+	}
+	switch a := a.(type) {
+	case traversal:
+		if a == next {
+			i = (i + 1) % len(screens)
+		} else {
+			i = (i + len(screens) - 1) % len(screens)
+		}
+	case int:
+		if a < 0 || len(screens) <= a {
+			return true
+		}
+		i = a
+	default:
+		return false
+	}
+	k1 := screens[i].workspace
+	if k1 == k {
+		return true
+	}
+	previous := k1.dummyWindow.link[prev]
+	if k1.focusedFrame.window != nil {
+		previous = k1.focusedFrame.window
+	}
+	migrate(w, k1, previous)
+	k.exitEmptyFullscreen()
+	k.focusFrame(k.focusedFrame)
+	makeLists()
+	if followMovedWindows && w.frame != nil {
+		warpPointerTo(w.frame)
+	}
+	return true
+}
+
 func doFrame(k *workspace, t1 interface{}) bool {
 	t, ok := t1.(traversal)
 	if !ok {
@@ -76,7 +130,7 @@ func doFrame(k *workspace, t1 interface{}) bool {
 
 func warpPointerTo(f *frame) {
 	f.workspace.focusFrame(f)
-	check(xp.WarpPointerChecked(xConn, xp.WindowNone, rootXWin, 0, 0, 0, 0,
+	check(xp.WarpPointerChecked(xConn, xp.WindowNone, f.workspace.root.xWin, 0, 0, 0, 0,
 		f.rect.X+int16(f.rect.Width/2),
 		f.rect.Y+int16(f.rect.Height/2),
 	))
@@ -151,7 +205,7 @@ func changeWindow(f0 *frame, w0, w1 *window) {
 	if w0 != nil {
 		w0.configure()
 	}
-	focus(w1)
+	focus(f0.workspace.root, w1)
 	makeLists()
 }
 
@@ -166,7 +220,7 @@ func doWorkspace(k0 *workspace, t1 interface{}) bool {
 		if k1 == k0 {
 			return true
 		}
-		if k1 == &dummyWorkspace {
+		if k1 == &k0.root.dummyWorkspace {
 			continue
 		}
 		if k1.screen == nil {
@@ -182,17 +236,95 @@ func doWorkspaceN(k0 *workspace, n1 interface{}) bool {
 	if !ok {
 		return false
 	}
-	k1 := dummyWorkspace.link[next]
-	for ; n > 0 && k1 != &dummyWorkspace; n-- {
+	dummy := &k0.root.dummyWorkspace
+	k1 := dummy.link[next]
+	for ; n > 0 && k1 != dummy; n-- {
 		k1 = k1.link[next]
 	}
-	if k1 == &dummyWorkspace || k1 == k0 {
+	if k1 == dummy || k1 == k0 {
 		return true
 	}
 	changeWorkspace(k0.screen, k0, k1)
 	return true
 }
 
+// doWindowWorkspaceN moves the focused frame's window to the Nth workspace. If
+// there are exactly N workspaces, a new one is created.
+func doWindowWorkspaceN(k0 *workspace, n1 interface{}) bool {
+	n, ok := n1.(int)
+	if !ok {
+		return false
+	}
+	w := k0.focusedFrame.window
+	if w == nil || k0.screen == nil {
+		return true
+	}
+	dummy := &k0.root.dummyWorkspace
+	k1 := dummy.link[next]
+	for ; n > 0 && k1 != dummy; n-- {
+		k1 = k1.link[next]
+	}
+	if k1 == dummy {
+		if n > 0 {
+			return true
+		}
+		k1 = newWorkspace(k0.screen.rect, dummy.link[prev])
+	}
+	if k1 == k0 {
+		return true
+	}
+	previous := k1.dummyWindow.link[prev]
+	if k1.focusedFrame.window != nil {
+		previous = k1.focusedFrame.window
+	}
+	migrate(w, k1, previous)
+	k0.exitEmptyFullscreen()
+	k0.focusFrame(k0.focusedFrame)
+	makeLists()
+	if followMovedWindows {
+		if k1.screen == nil {
+			changeWorkspace(k0.screen, k0, k1)
+		}
+		if w.frame != nil {
+			warpPointerTo(w.frame)
+		}
+	}
+	return true
+}
+
+// doWorkspaceRename prompts for a new name for the current workspace.
+func doWorkspaceRename(k *workspace, _ interface{}) bool {
+	startTyping(k, listWorkspaces, "Rename workspace: ", k.name, func(k *workspace, text string) {
+		k.name = strings.TrimSpace(text)
+		makeLists()
+	})
+	return false
+}
+
+// doWorkspaceNamed switches to the workspace with the name given by the
+// argument, or prompts for a name if the argument is nil.
+func doWorkspaceNamed(k0 *workspace, name1 interface{}) bool {
+	if name1 == nil {
+		startTyping(k0, listWorkspaces, "Go to workspace: ", "", func(k0 *workspace, text string) {
+			if k0.screen == nil {
+				return
+			}
+			if k1 := k0.root.findWorkspaceNamed(strings.TrimSpace(text)); k1 != nil && k1 != k0 {
+				changeWorkspace(k0.screen, k0, k1)
+			}
+		})
+		return false
+	}
+	name, ok := name1.(string)
+	if !ok {
+		return false
+	}
+	if k1 := k0.root.findWorkspaceNamed(name); k1 != nil && k1 != k0 {
+		changeWorkspace(k0.screen, k0, k1)
+	}
+	return true
+}
+
 func doWorkspaceNew(k0 *workspace, _ interface{}) bool {
 	s := k0.screen
 	changeWorkspace(s, k0, newWorkspace(s.rect, k0))
@@ -215,7 +347,7 @@ func changeWorkspace(s0 *screen, k0, k1 *workspace) {
 	}
 	k1.layout()
 	k0.layout()
-	p, err := xp.QueryPointer(xConn, rootXWin).Reply()
+	p, err := xp.QueryPointer(xConn, k1.root.xWin).Reply()
 	if err != nil {
 		log.Println(err)
 	}
@@ -231,14 +363,122 @@ func changeWorkspace(s0 *screen, k0, k1 *workspace) {
 	makeLists()
 }
 
+var (
+	deleteTime time.Time
+	deleteXWin xp.Window
+)
+
 func doWindowDelete(k *workspace, _ interface{}) bool {
 	w := k.focusedFrame.window
-	if w != nil && w.wmDeleteWindow {
-		sendClientMessage(w.xWin, atomWMDeleteWindow)
+	if w == nil {
+		return true
 	}
+	now := time.Now()
+	again := deleteXWin == w.xWin && now.Sub(deleteTime) < killDuration
+	deleteTime, deleteXWin = now, w.xWin
+	if again {
+		// The user insists.
+		return doWindowKill(k, nil)
+	}
+	if !w.wmDeleteWindow {
+		// The window can't be closed politely, and killing it takes a second
+		// press, in case this one was a mistake. Flashing the border warns
+		// that the second press will kill it.
+		flash(k.focusedFrame)
+		return false
+	}
+	// If the program has hung, it won't reply to the ping, and the window will
+	// be marked as unresponsive, to be killed by doWindowKill.
+	ping(w)
+	sendClientMessage(w.xWin, atomWMDeleteWindow)
 	return true
 }
 
+func doWindowKill(k *workspace, _ interface{}) bool {
+	w := k.focusedFrame.window
+	if w == nil {
+		return true
+	}
+	deleteTime, deleteXWin = time.Time{}, 0
+	flash(k.focusedFrame)
+	killWindow(w)
+	return false
+}
+
+// killWindow forcibly closes the window by closing its program's connection to
+// the X server. A hung program may never notice that, so if the window has
+// failed to reply to a _NET_WM_PING, and its program runs on this machine and
+// announced its process ID, then that process is killed instead. A matching
+// WM_CLIENT_MACHINE alone is not enough to trust _NET_WM_PID, as containers
+// and virtual machines often share hostnames.
+func killWindow(w *window) {
+	if !w.unresponsive {
+		check(xp.KillClientChecked(xConn, uint32(w.xWin)))
+		return
+	}
+	if v := cardinals(w.xWin, atomNetWMPID); len(v) > 0 && v[0] > 1 && int(v[0]) != os.Getpid() {
+		machine := w.property(atomWMClientMachine)
+		if i := strings.IndexByte(machine, '\x00'); i >= 0 {
+			machine = machine[:i]
+		}
+		if hostname, err := os.Hostname(); err == nil && hostname == machine {
+			err := syscall.Kill(int(v[0]), syscall.SIGKILL)
+			if err == nil {
+				return
+			}
+			log.Printf("could not kill process %d: %v", v[0], err)
+		}
+	}
+	check(xp.KillClientChecked(xConn, uint32(w.xWin)))
+}
+
+func doWindowUrgent(k0 *workspace, _ interface{}) bool {
+	w := (*window)(nil)
+	findWindow(func(w1 *window) bool {
+		if w1.urgent && (w == nil || w.urgentSeqNum < w1.urgentSeqNum) {
+			w = w1
+		}
+		return false
+	})
+	if w == nil {
+		return true
+	}
+	goToWindow(k0, w)
+	return true
+}
+
+// showWindow moves w to k's focused frame or, if w is in another workspace,
+// goes to w.
+func showWindow(k *workspace, w *window) {
+	if w.workspace() == k {
+		f := k.focusedFrame
+		changeWindow(f, f.window, w)
+	} else {
+		goToWindow(k, w)
+	}
+}
+
+// goToWindow shows w's workspace, on k0's screen if it is hidden, and focuses
+// w, showing it in the focused frame if it isn't already framed.
+func goToWindow(k0 *workspace, w *window) {
+	k1 := w.workspace()
+	if k1 == nil {
+		return
+	}
+	if k1.screen == nil {
+		s := k0.screen
+		if k1.root != k0.root || s == nil {
+			s = k1.root.screens[0]
+		}
+		changeWorkspace(s, s.workspace, k1)
+	}
+	if w.frame == nil {
+		f := k1.focusedFrame
+		changeWindow(f, f.window, w)
+	}
+	warpPointerTo(w.frame)
+}
+
 func doWorkspaceDelete(k0 *workspace, _ interface{}) bool {
 	if k0.dummyWindow.link[next] != &k0.dummyWindow {
 		// Workspace-delete fails if the workspace contains a window.
@@ -250,7 +490,7 @@ func doWorkspaceDelete(k0 *workspace, _ interface{}) bool {
 		if k1 == k0 {
 			return true
 		}
-		if k1 == &dummyWorkspace {
+		if k1 == &k0.root.dummyWorkspace {
 			continue
 		}
 		if k1.screen == nil {
@@ -263,7 +503,7 @@ func doWorkspaceDelete(k0 *workspace, _ interface{}) bool {
 	s.workspace, k1.screen = k1, s
 	*k0 = workspace{}
 	k1.layout()
-	focus(k1.focusedFrame.window)
+	focus(k1.root, k1.focusedFrame.window)
 	s.repaint()
 	makeLists()
 	return true
@@ -275,7 +515,8 @@ func doList(k *workspace, l1 interface{}) bool {
 		return false
 	}
 	if k.listing != l {
-		k.listing = l
+		reconcile()
+		k.listing, k.scroll = l, 0
 	} else {
 		k.listing = listNone
 	}
@@ -284,6 +525,85 @@ func doList(k *workspace, l1 interface{}) bool {
 	return false
 }
 
+// doListHint shows a list, labelling each item with a hint from hintLabels, and
+// selects the item whose hint is typed.
+func doListHint(k *workspace, l1 interface{}) bool {
+	l, ok := l1.(listing)
+	if !ok {
+		return false
+	}
+	t := startTyping(k, l, "Type a hint: ", "", func(*workspace, string) {})
+	if t == nil {
+		return false
+	}
+	t.hints = true
+	t.edit = func(k *workspace, text string) {
+		hints := hintLabels(len(k.list))
+		for i, hint := range hints {
+			if hint == text {
+				item := k.list[i]
+				stopTyping()
+				switch item := item.(type) {
+				case *window:
+					showWindow(k, item)
+				case *workspace:
+					if k.screen != nil && item != k {
+						changeWorkspace(k.screen, k, item)
+					}
+				}
+				return
+			}
+			if strings.HasPrefix(hint, text) {
+				return
+			}
+		}
+		// No hint starts with the text, so ignore the last key press.
+		if text != "" {
+			typing.text = text[:len(text)-1]
+		}
+	}
+	k.screen.repaint()
+	return false
+}
+
+// doListSearch shows a list of all of the root's windows, filtered by what is
+// typed. The Up and Down keys move the list's cursor, and the Return key goes
+// to the window under the cursor.
+func doListSearch(k *workspace, _ interface{}) bool {
+	startTyping(k, listSearch, "Search: ", "", func(k *workspace, _ string) {
+		i := k.index
+		if i < 0 {
+			i = 0
+		}
+		if i >= len(k.list) {
+			return
+		}
+		if w, ok := k.list[i].(*window); ok {
+			showWindow(k, w)
+		}
+	})
+	return false
+}
+
+// doListScroll scrolls the list overlay by the argument's number of rows.
+func doListScroll(k *workspace, n1 interface{}) bool {
+	n, ok := n1.(int)
+	if !ok {
+		return false
+	}
+	if k.listing == listNone {
+		return false
+	}
+	k.scrollList(n)
+	if p, err := xp.QueryPointer(xConn, k.root.xWin).Reply(); err != nil {
+		log.Println(err)
+	} else if p != nil {
+		k.index = k.followPointer(p.RootX, p.RootY)
+	}
+	k.screen.repaint()
+	return false
+}
+
 func doWindowNudge(k *workspace, t1 interface{}) bool {
 	t, ok := t1.(traversal)
 	if !ok {
@@ -359,7 +679,8 @@ func doWorkspaceMigrate(k *workspace, _ interface{}) bool {
 		previous = k.focusedFrame.window
 	}
 	var migrants []*window
-	for k0 := dummyWorkspace.link[next]; k0 != &dummyWorkspace; k0 = k0.link[next] {
+	r := k.root
+	for k0 := r.dummyWorkspace.link[next]; k0 != &r.dummyWorkspace; k0 = k0.link[next] {
 		migrants = migrants[:0]
 		for w := k0.dummyWindow.link[next]; w != &k0.dummyWindow; w = w.link[next] {
 			if !w.selected {
@@ -372,45 +693,57 @@ func doWorkspaceMigrate(k *workspace, _ interface{}) bool {
 			migrants = append(migrants, w)
 		}
 		for _, w := range migrants {
-			if f := w.frame; f != nil {
-				f.window, w.frame = nil, nil
-			}
-			wn, wp := w.link[next], w.link[prev]
-			wn.link[prev] = wp
-			wp.link[next] = wn
-			wn, wp = previous.link[next], previous
-			wn.link[prev] = w
-			wp.link[next] = w
-			w.link[next], w.link[prev] = wn, wp
+			migrate(w, k, previous)
 			previous = w
-
-			f := k.focusedFrame
-			if f.window != nil {
-				f = k.mainFrame.firstEmptyFrame()
-			}
-			if f != nil {
-				f.window, w.frame = w, f
-			}
-			w.configure()
-		}
-		if k0.fullscreen && k0.focusedFrame.window == nil {
-			if k0.screen != nil {
-				doFullscreen(k0, nil)
-			} else {
-				k0.fullscreen = false
-			}
 		}
+		k0.exitEmptyFullscreen()
 	}
 	makeLists()
 	return true
 }
 
+// migrate moves w to k's list of windows, after previous, and shows it in k's
+// focused frame if that is empty, or else k's first empty frame.
+func migrate(w *window, k *workspace, previous *window) {
+	if f := w.frame; f != nil {
+		f.window, w.frame = nil, nil
+	}
+	wn, wp := w.link[next], w.link[prev]
+	wn.link[prev] = wp
+	wp.link[next] = wn
+	wn, wp = previous.link[next], previous
+	wn.link[prev] = w
+	wp.link[next] = w
+	w.link[next], w.link[prev] = wn, wp
+
+	f := k.focusedFrame
+	if f.window != nil {
+		f = k.mainFrame.firstEmptyFrame()
+	}
+	if f != nil {
+		f.window, w.frame = w, f
+	}
+	w.configure()
+}
+
+// exitEmptyFullscreen leaves fullscreen mode if the fullscreen window has
+// moved away.
+func (k *workspace) exitEmptyFullscreen() {
+	if k.fullscreen && k.focusedFrame.window == nil {
+		if k.screen != nil {
+			doFullscreen(k, nil)
+		} else {
+			k.fullscreen = false
+		}
+	}
+}
+
 func doFullscreen(k *workspace, _ interface{}) bool {
 	if !k.fullscreen && k.focusedFrame.window == nil {
 		return true
 	}
 	k.fullscreen = !k.fullscreen
-	if p, err := xp.QueryPointer(xConn, rootXWin).Reply(); err != nil {
+	if p, err := xp.QueryPointer(xConn, k.root.xWin).Reply(); err != nil {
 		log.Println(err)
 	} else if p != nil {
 		k.focusFrame(k.frameContaining(p.RootX, p.RootY))
@@ -504,7 +837,7 @@ func doSplit(k *workspace, o1 interface{}) bool {
 }
 
 func finishMergeSplit(k *workspace) {
-	p, err := xp.QueryPointer(xConn, rootXWin).Reply()
+	p, err := xp.QueryPointer(xConn, k.root.xWin).Reply()
 	if err != nil {
 		log.Println(err)
 	}
@@ -526,11 +859,7 @@ func doProgramAction(k *workspace, pa1 interface{}) bool {
 	if w == nil {
 		return false
 	}
-	class := w.property(atomWMClass)
-	if i := strings.Index(class, "\x00"); i >= 0 {
-		class = class[:i]
-	}
-	a := programActions[class][pa]
+	a := programActions[w.class][pa]
 	if a.keysym == 0 {
 		return false
 	}
@@ -550,7 +879,7 @@ func sendSynthetic(w *window, state uint16, buttonOrKeysym interface{}) {
 	// except for the first byte (the X11 message type).
 	e := xp.KeyPressEvent{
 		Time:       eventTime,
-		Root:       rootXWin,
+		Root:       w.frame.workspace.root.xWin,
 		Event:      w.xWin,
 		Child:      w.xWin,
 		RootX:      keyRootX,
@@ -569,14 +898,12 @@ func sendSynthetic(w *window, state uint16, buttonOrKeysym interface{}) {
 	case xp.Keysym:
 		msg0 = xp.KeyPress
 		msg1 = xp.KeyRelease
-		keycode, shift := findKeycode(bk)
+		keycode, state := findKeycode(bk)
 		if keycode == 0 {
 			return
 		}
 		e.Detail = keycode
-		if shift {
-			e.State |= xp.KeyButMaskShift
-		}
+		e.State |= state
 	default:
 		return
 	}
@@ -608,11 +935,13 @@ func doQuit(_ *workspace, _ interface{}) bool {
 	quitting = true
 
 	waiting := false
-	for k := dummyWorkspace.link[next]; k != &dummyWorkspace; k = k.link[next] {
-		for w := k.dummyWindow.link[next]; w != &k.dummyWindow; w = w.link[next] {
-			if w.wmDeleteWindow {
-				waiting = true
-				sendClientMessage(w.xWin, atomWMDeleteWindow)
+	for _, r := range roots {
+		for k := r.dummyWorkspace.link[next]; k != &r.dummyWorkspace; k = k.link[next] {
+			for w := k.dummyWindow.link[next]; w != &k.dummyWindow; w = w.link[next] {
+				if w.wmDeleteWindow {
+					waiting = true
+					sendClientMessage(w.xWin, atomWMDeleteWindow)
+				}
 			}
 		}
 	}
@@ -629,8 +958,8 @@ func doQuit(_ *workspace, _ interface{}) bool {
 
 var previousFocusXWin xp.Window
 
-func focus(w *window) {
-	xWin := desktopXWin
+func focus(r *root, w *window) {
+	xWin := r.desktopXWin
 	if w != nil {
 		xWin = w.xWin
 	}
@@ -638,6 +967,10 @@ func focus(w *window) {
 		return
 	}
 	previousFocusXWin = xWin
+	if w != nil && w.urgent {
+		w.urgent = false
+		makeLists()
+	}
 
 	active := []byte{
 		byte(xWin >> 0),
@@ -645,7 +978,7 @@ func focus(w *window) {
 		byte(xWin >> 16),
 		byte(xWin >> 24),
 	}
-	if err := xp.ChangePropertyChecked(xConn, xp.PropModeReplace, rootXWin,
+	if err := xp.ChangePropertyChecked(xConn, xp.PropModeReplace, r.xWin,
 		atomNetActiveWindow, atomWindow, 32, 1, active).Check(); err != nil {
 		log.Printf("could not set _NET_ACTIVE_WINDOW: %v", err)
 	}
@@ -20,6 +20,11 @@ const (
 	colorQuitUnfocused  = 0x7f1f1f
 	colorQuitFocused    = 0xff3f3f
 
+	// colorUrgentXxx are the colors that borders pulse to when a window asks
+	// for attention, such as a chat program receiving a message.
+	colorUrgentUnfocused = 0x7f5f1f
+	colorUrgentFocused   = 0xffbf3f
+
 	// dpi is the Dots Per Inch screen resolution. Hard-coding 96 DPI is the
 	// same as what 2012-era gnome-settings-daemon does. For significantly
 	// higher resolution screens, this value should be larger. Integer
@@ -30,10 +35,41 @@ const (
 	pulseFrameDuration = 50 * time.Millisecond
 	pulseTotalDuration = 1000 * time.Millisecond
 
+	// flashDuration is how long a frame's border is drawn in the quit color
+	// when its window is killed.
+	flashDuration = 250 * time.Millisecond
+
+	// killDuration is the interval within which pressing the close window key
+	// twice kills the window, for programs that don't close when asked.
+	killDuration = 1 * time.Second
+
 	// quitDuration is the grace period, when quitting, for programs to exit
 	// cleanly.
 	quitDuration = 60 * time.Second
 
+	// pingTimeout is how long a program has to reply to a _NET_WM_PING before
+	// its window is marked as unresponsive.
+	pingTimeout = 5 * time.Second
+
+	// reconcileDuration is how often to check for windows that no longer
+	// exist, such as those of crashed programs, but are still listed.
+	reconcileDuration = 30 * time.Second
+
+	// listScrollRows is how many rows the mouse wheel scrolls a list by.
+	listScrollRows = 3
+
+	// dragDistance is how far, in pixels, the mouse has to move with a button
+	// held down to be a drag gesture instead of a click.
+	dragDistance = 64
+
+	// followMovedWindows is whether moving a window to another screen or
+	// workspace also moves the focus there.
+	followMovedWindows = false
+
+	// hintChars are the characters that make up the labels for selecting a
+	// list item by typing, like a web browser's link hints.
+	hintChars = "asdfghjkl"
+
 	showBatteryPercentage = false
 )
 
@@ -78,124 +114,259 @@ var xSettings = [...]struct {
 	{"Xft/RGBA", "none"},
 }
 
+// virtualScreens splits a monitor, such as an ultra-wide one, into several
+// screens, each with its own workspace. The map keys are RandR output names,
+// such as "DP-1", as listed by "xrandr --query". The key "" applies to monitors
+// without a name, such as those found via Xinerama instead of RandR. Each
+// rectangle's X and Y are relative to the monitor's top-left corner. Monitors
+// not listed here are one screen each.
+var virtualScreens = map[string][]xp.Rectangle{
+	// For example, to split a 5120x1440 monitor into three:
+	//
+	// "DP-1": {
+	// 	{X: 0, Y: 0, Width: 1280, Height: 1440},
+	// 	{X: 1280, Y: 0, Width: 2560, Height: 1440},
+	// 	{X: 3840, Y: 0, Width: 1280, Height: 1440},
+	// },
+}
+
+// defaultWorkspaceNames are the names given to new workspaces, in order. Each
+// name is used at most once, and a workspace can be renamed with Caps Lock and
+// Shift and the 'Q' key. A key binding can go straight to a named workspace:
+//
+//	+xkHome: {doWorkspaceNamed, "mail", "go to the %s workspace"},
+var defaultWorkspaceNames = []string{
+	// "mail",
+	// "build",
+	// "docs",
+}
+
 const doAudioActions = true
 
+// action is what to do for a key press: call the do function with the
+// argument. The description is shown by the palette of all actions (Caps Lock
+// and Shift and the '"' key), with any "%s" replaced by a description of the
+// argument.
+type action struct {
+	do   func(*workspace, interface{}) bool
+	arg  interface{}
+	desc string
+}
+
 // actions lists the action to be performed for each key press. The do function
 // returns whether to pulsate the frames' borders to acknowledge the key press.
 //
 // The map keys are X11 keysyms as int32s. The unary +/^ means whether the
 // shift modifier needs to be absent/present.
-var actions = map[int32]struct {
-	do  func(*workspace, interface{}) bool
-	arg interface{}
-}{
-	+' ':      {doExec, []string{"google-chrome"}},
-	^' ':      {doExec, []string{"google-chrome", "--incognito"}},
-	^'|':      {doExec, []string{"gnome-screensaver-command", "-l"}},
-	+xkReturn: {doExec, []string{"gnome-terminal"}}, // "taote" is another option.
-	^xkReturn: {doExec, []string{"dmenu_run", "-nb", "#0f0f0f", "-nf", "#3f7f3f",
-		"-sb", "#0f0f0f", "-sf", "#7fff7f", "-l", "10"}},
-
-	+xkAudioLowerVolume: {doAudio, []string{"pactl", "set-sink-volume", "@DEFAULT_SINK@", "-5%"}},
-	+xkAudioRaiseVolume: {doAudio, []string{"pactl", "set-sink-volume", "@DEFAULT_SINK@", "+5%"}},
-	+xkAudioMute:        {doAudio, []string{"pactl", "set-sink-mute", "@DEFAULT_SINK@", "toggle"}},
-
-	+xkBackspace: {doWindowDelete, nil},
-	^xkEscape:    {doQuit, nil},
-
-	+'`':          {doScreen, next},
-	^'~':          {doScreen, prev},
-	+xkTab:        {doFrame, next},
-	^xkISOLeftTab: {doFrame, prev},
-
-	+'q': {doList, listWorkspaces},
-	+'w': {doWorkspaceMigrate, nil},
-	+'e': {doWorkspace, prev},
-	^'E': {doWorkspaceNudge, prev},
-	+'r': {doWorkspace, next},
-	^'R': {doWorkspaceNudge, next},
-	+'t': {doWorkspaceNew, nil},
-	^'T': {doWorkspaceDelete, nil},
-
-	+'a': {doList, listWindows},
-	+'s': {doWindowSelect, false},
-	^'S': {doWindowSelect, true},
-	+'d': {doWindow, prev},
-	^'D': {doWindowNudge, prev},
-	+'f': {doWindow, next},
-	^'F': {doWindowNudge, next},
-	+'g': {doFullscreen, nil},
-	^'G': {doHide, nil},
-
-	+'-': {doSplit, horizontal},
-	+'=': {doSplit, vertical},
-	^'+': {doMerge, nil},
-
-	+'1': {doWindowN, 0},
-	+'2': {doWindowN, 1},
-	+'3': {doWindowN, 2},
-	+'4': {doWindowN, 3},
-	+'5': {doWindowN, 4},
-	+'6': {doWindowN, 5},
-	+'7': {doWindowN, 6},
-	+'8': {doWindowN, 7},
-	+'9': {doWindowN, 8},
-	+'0': {doWindowN, 9},
-
-	+xkF1:  {doWorkspaceN, 0},
-	+xkF2:  {doWorkspaceN, 1},
-	+xkF3:  {doWorkspaceN, 2},
-	+xkF4:  {doWorkspaceN, 3},
-	+xkF5:  {doWorkspaceN, 4},
-	+xkF6:  {doWorkspaceN, 5},
-	+xkF7:  {doWorkspaceN, 6},
-	+xkF8:  {doWorkspaceN, 7},
-	+xkF9:  {doWorkspaceN, 8},
-	+xkF10: {doWorkspaceN, 9},
-	+xkF11: {doWorkspaceN, 10},
-	+xkF12: {doWorkspaceN, 11},
-
-	+'i': {doSynthetic, xp.Button(4)},
-	^'I': {doSynthetic, xp.Button(4)},
-	+'m': {doSynthetic, xp.Button(5)},
-	^'M': {doSynthetic, xp.Button(5)},
-	+'y': {doSynthetic, xp.Keysym(xkHome)},
-	^'Y': {doSynthetic, xp.Keysym(xkHome)},
-	+'u': {doSynthetic, xp.Keysym(xkPageUp)},
-	^'U': {doSynthetic, xp.Keysym(xkPageUp)},
-	+'h': {doSynthetic, xp.Keysym(xkLeft)},
-	^'H': {doSynthetic, xp.Keysym(xkLeft)},
-	+'j': {doSynthetic, xp.Keysym(xkDown)},
-	^'J': {doSynthetic, xp.Keysym(xkDown)},
-	+'k': {doSynthetic, xp.Keysym(xkUp)},
-	^'K': {doSynthetic, xp.Keysym(xkUp)},
-	+'l': {doSynthetic, xp.Keysym(xkRight)},
-	^'L': {doSynthetic, xp.Keysym(xkRight)},
-	+'b': {doSynthetic, xp.Keysym(xkEnd)},
-	^'B': {doSynthetic, xp.Keysym(xkEnd)},
-	+'n': {doSynthetic, xp.Keysym(xkPageDown)},
-	^'N': {doSynthetic, xp.Keysym(xkPageDown)},
-	+',': {doSynthetic, xp.Keysym(xkBackspace)},
-	^'<': {doSynthetic, xp.Keysym(xkBackspace)},
-	+'.': {doSynthetic, xp.Keysym(xkDelete)},
-	^'>': {doSynthetic, xp.Keysym(xkDelete)},
-
-	+'/':  {doProgramAction, paTabNew},
-	^'?':  {doProgramAction, paTabClose},
-	+'c':  {doProgramAction, paTabPrev},
-	^'C':  {doProgramAction, paTabNudgePrev},
-	+'v':  {doProgramAction, paTabNext},
-	^'V':  {doProgramAction, paTabNudgeNext},
-	+'\'': {doProgramAction, paSearch},
-	+'o':  {doProgramAction, paCopy},
-	^'O':  {doProgramAction, paCut},
-	+'p':  {doProgramAction, paPaste},
-	^'P':  {doProgramAction, paPasteSpecial},
-	+'z':  {doProgramAction, paZoomIn},
-	^'Z':  {doProgramAction, paZoomReset},
-	+'x':  {doProgramAction, paZoomOut},
-	+';':  {doProgramAction, paThemeNext},
-	^':':  {doProgramAction, paThemePrev},
+var actions = map[int32]action{
+	+' ':      {doExec, []string{"google-chrome"}, "run %s"},
+	^' ':      {doExec, []string{"google-chrome", "--incognito"}, "run %s"},
+	^'|':      {doExec, []string{"gnome-screensaver-command", "-l"}, "run %s"},
+	+xkReturn: {doExec, []string{"gnome-terminal"}, "run %s"}, // "taote" is another option.
+	^xkReturn: {doLaunch, nil, "launch a program"},
+
+	+xkAudioLowerVolume: {doAudio, []string{"pactl", "set-sink-volume", "@DEFAULT_SINK@", "-5%"}, "lower the volume"},
+	+xkAudioRaiseVolume: {doAudio, []string{"pactl", "set-sink-volume", "@DEFAULT_SINK@", "+5%"}, "raise the volume"},
+	+xkAudioMute:        {doAudio, []string{"pactl", "set-sink-mute", "@DEFAULT_SINK@", "toggle"}, "mute or unmute the volume"},
+
+	+xkBackspace: {doWindowDelete, nil, "close the focused window"},
+	^xkBackspace: {doWindowKill, nil, "kill the focused window"},
+	^'!':         {doWindowUrgent, nil, "show the window asking for attention"},
+	^xkEscape:    {doQuit, nil, "quit taowm"},
+
+	+'`':          {doScreen, next, "focus the %s screen"},
+	^'~':          {doScreen, prev, "focus the %s screen"},
+	+'[':          {doScreenMigrate, prev, "move the focused window to the %s screen"},
+	+']':          {doScreenMigrate, next, "move the focused window to the %s screen"},
+	+xkTab:        {doFrame, next, "focus the %s frame"},
+	^xkISOLeftTab: {doFrame, prev, "focus the %s frame"},
+
+	+'q': {doList, listWorkspaces, "list %s"},
+	+'w': {doWorkspaceMigrate, nil, "move the selected windows to this workspace"},
+	+'e': {doWorkspace, prev, "show the %s hidden workspace"},
+	^'E': {doWorkspaceNudge, prev, "move the workspace to the %s position"},
+	+'r': {doWorkspace, next, "show the %s hidden workspace"},
+	^'R': {doWorkspaceNudge, next, "move the workspace to the %s position"},
+	+'t': {doWorkspaceNew, nil, "create a workspace"},
+	^'T': {doWorkspaceDelete, nil, "delete the workspace"},
+	^'Q': {doWorkspaceRename, nil, "rename the workspace"},
+	^'W': {doWorkspaceNamed, nil, "go to a workspace by name"},
+
+	+'a': {doList, listWindows, "list %s"},
+	^'A': {doListHint, listWindows, "list %s, with labels to type"},
+	^'X': {doListHint, listWorkspaces, "list %s, with labels to type"},
+	+'s': {doWindowSelect, false, "select or unselect the focused window"},
+	^'S': {doWindowSelect, true, "select or unselect all windows"},
+	+'d': {doWindow, prev, "show the %s hidden window"},
+	^'D': {doWindowNudge, prev, "move the focused window to the %s position"},
+	+'f': {doWindow, next, "show the %s hidden window"},
+	^'F': {doWindowNudge, next, "move the focused window to the %s position"},
+	+'g': {doFullscreen, nil, "toggle fullscreen"},
+	^'G': {doHide, nil, "hide the focused window"},
+
+	+'\\': {doListSearch, nil, "search for a window"},
+	^'"':  {doPalette, nil, "list all actions"},
+	^'{':  {doKeymap, frameMode, "use the %s keys"},
+	^'}':  {doKeymap, windowKeymap, "use the %s keys"},
+
+	+'-': {doSplit, horizontal, "split the focused frame %s"},
+	+'=': {doSplit, vertical, "split the focused frame %s"},
+	^'+': {doMerge, nil, "merge the focused frame"},
+
+	+'1': {doWindowN, 0, "show window %s"},
+	+'2': {doWindowN, 1, "show window %s"},
+	+'3': {doWindowN, 2, "show window %s"},
+	+'4': {doWindowN, 3, "show window %s"},
+	+'5': {doWindowN, 4, "show window %s"},
+	+'6': {doWindowN, 5, "show window %s"},
+	+'7': {doWindowN, 6, "show window %s"},
+	+'8': {doWindowN, 7, "show window %s"},
+	+'9': {doWindowN, 8, "show window %s"},
+	+'0': {doWindowN, 9, "show window %s"},
+
+	// Shift and the '2' to '9' keys move the focused window to the 2nd to 9th
+	// screen. Shift and the '1' key shows the window asking for attention.
+	^'@': {doScreenMigrate, 1, "move the focused window to screen %s"},
+	^'#': {doScreenMigrate, 2, "move the focused window to screen %s"},
+	^'$': {doScreenMigrate, 3, "move the focused window to screen %s"},
+	^'%': {doScreenMigrate, 4, "move the focused window to screen %s"},
+	^'^': {doScreenMigrate, 5, "move the focused window to screen %s"},
+	^'&': {doScreenMigrate, 6, "move the focused window to screen %s"},
+	^'*': {doScreenMigrate, 7, "move the focused window to screen %s"},
+	^'(': {doScreenMigrate, 8, "move the focused window to screen %s"},
+
+	+xkF1:  {doWorkspaceN, 0, "show workspace %s"},
+	+xkF2:  {doWorkspaceN, 1, "show workspace %s"},
+	+xkF3:  {doWorkspaceN, 2, "show workspace %s"},
+	+xkF4:  {doWorkspaceN, 3, "show workspace %s"},
+	+xkF5:  {doWorkspaceN, 4, "show workspace %s"},
+	+xkF6:  {doWorkspaceN, 5, "show workspace %s"},
+	+xkF7:  {doWorkspaceN, 6, "show workspace %s"},
+	+xkF8:  {doWorkspaceN, 7, "show workspace %s"},
+	+xkF9:  {doWorkspaceN, 8, "show workspace %s"},
+	+xkF10: {doWorkspaceN, 9, "show workspace %s"},
+	+xkF11: {doWorkspaceN, 10, "show workspace %s"},
+	+xkF12: {doWorkspaceN, 11, "show workspace %s"},
+
+	^xkF1:  {doWindowWorkspaceN, 0, "move the focused window to workspace %s"},
+	^xkF2:  {doWindowWorkspaceN, 1, "move the focused window to workspace %s"},
+	^xkF3:  {doWindowWorkspaceN, 2, "move the focused window to workspace %s"},
+	^xkF4:  {doWindowWorkspaceN, 3, "move the focused window to workspace %s"},
+	^xkF5:  {doWindowWorkspaceN, 4, "move the focused window to workspace %s"},
+	^xkF6:  {doWindowWorkspaceN, 5, "move the focused window to workspace %s"},
+	^xkF7:  {doWindowWorkspaceN, 6, "move the focused window to workspace %s"},
+	^xkF8:  {doWindowWorkspaceN, 7, "move the focused window to workspace %s"},
+	^xkF9:  {doWindowWorkspaceN, 8, "move the focused window to workspace %s"},
+	^xkF10: {doWindowWorkspaceN, 9, "move the focused window to workspace %s"},
+	^xkF11: {doWindowWorkspaceN, 10, "move the focused window to workspace %s"},
+	^xkF12: {doWindowWorkspaceN, 11, "move the focused window to workspace %s"},
+
+	+'i': {doSynthetic, xp.Button(4), "send %s"},
+	^'I': {doSynthetic, xp.Button(4), "send %s"},
+	+'m': {doSynthetic, xp.Button(5), "send %s"},
+	^'M': {doSynthetic, xp.Button(5), "send %s"},
+	+'y': {doSynthetic, xp.Keysym(xkHome), "send %s"},
+	^'Y': {doSynthetic, xp.Keysym(xkHome), "send %s"},
+	+'u': {doSynthetic, xp.Keysym(xkPageUp), "send %s"},
+	^'U': {doSynthetic, xp.Keysym(xkPageUp), "send %s"},
+	+'h': {doSynthetic, xp.Keysym(xkLeft), "send %s"},
+	^'H': {doSynthetic, xp.Keysym(xkLeft), "send %s"},
+	+'j': {doSynthetic, xp.Keysym(xkDown), "send %s"},
+	^'J': {doSynthetic, xp.Keysym(xkDown), "send %s"},
+	+'k': {doSynthetic, xp.Keysym(xkUp), "send %s"},
+	^'K': {doSynthetic, xp.Keysym(xkUp), "send %s"},
+	+'l': {doSynthetic, xp.Keysym(xkRight), "send %s"},
+	^'L': {doSynthetic, xp.Keysym(xkRight), "send %s"},
+	+'b': {doSynthetic, xp.Keysym(xkEnd), "send %s"},
+	^'B': {doSynthetic, xp.Keysym(xkEnd), "send %s"},
+	+'n': {doSynthetic, xp.Keysym(xkPageDown), "send %s"},
+	^'N': {doSynthetic, xp.Keysym(xkPageDown), "send %s"},
+	+',': {doSynthetic, xp.Keysym(xkBackspace), "send %s"},
+	^'<': {doSynthetic, xp.Keysym(xkBackspace), "send %s"},
+	+'.': {doSynthetic, xp.Keysym(xkDelete), "send %s"},
+	^'>': {doSynthetic, xp.Keysym(xkDelete), "send %s"},
+
+	+'/':  {doProgramAction, paTabNew, "program: %s"},
+	^'?':  {doProgramAction, paTabClose, "program: %s"},
+	+'c':  {doProgramAction, paTabPrev, "program: %s"},
+	^'C':  {doProgramAction, paTabNudgePrev, "program: %s"},
+	+'v':  {doProgramAction, paTabNext, "program: %s"},
+	^'V':  {doProgramAction, paTabNudgeNext, "program: %s"},
+	+'\'': {doProgramAction, paSearch, "program: %s"},
+	+'o':  {doProgramAction, paCopy, "program: %s"},
+	^'O':  {doProgramAction, paCut, "program: %s"},
+	+'p':  {doProgramAction, paPaste, "program: %s"},
+	^'P':  {doProgramAction, paPasteSpecial, "program: %s"},
+	+'z':  {doProgramAction, paZoomIn, "program: %s"},
+	^'Z':  {doProgramAction, paZoomReset, "program: %s"},
+	+'x':  {doProgramAction, paZoomOut, "program: %s"},
+	+';':  {doProgramAction, paThemeNext, "program: %s"},
+	^':':  {doProgramAction, paThemePrev, "program: %s"},
+}
+
+// mouseActions lists the action to be performed for each mouse button, in
+// each mouseContext and with the given modifiers. Mouse buttons 1, 2 and 3 are
+// the left, middle and right buttons, and 4 and 5 are the wheel scrolling up
+// and down. The dragXxx pseudo-buttons are mouse gestures, and anyButton is
+// every button without a binding of its own. Clicking on a list overlay's item
+// always chooses that item. For example, to merge frames by middle-clicking on
+// their border:
+//
+//	{mouseBorder, 2, 0}: {doMerge, nil, "merge the focused frame"},
+var mouseActions = map[mouseBinding]action{
+	{mouseDesktop, 1, 0}:               {doList, listWindows, "list %s"},
+	{mouseDesktop, 2, 0}:               {doWindow, next, "show the %s hidden window"},
+	{mouseDesktop, 2, xp.ModMaskShift}: {doWindow, prev, "show the %s hidden window"},
+	{mouseDesktop, 3, 0}:               {doList, listWorkspaces, "list %s"},
+	{mouseDesktop, 4, 0}:               {doWindow, prev, "show the %s hidden window"},
+	{mouseDesktop, 5, 0}:               {doWindow, next, "show the %s hidden window"},
+
+	// Whichever button is clicked or wheel scrolled, Control shows the next
+	// hidden window, Control and Shift the previous one, and Alt lists the
+	// workspaces.
+	{mouseDesktop, anyButton, xp.ModMaskControl}:                   {doWindow, next, "show the %s hidden window"},
+	{mouseDesktop, anyButton, xp.ModMaskControl | xp.ModMaskShift}: {doWindow, prev, "show the %s hidden window"},
+	{mouseDesktop, anyButton, xp.ModMask1}:                         {doList, listWorkspaces, "list %s"},
+
+	{mouseDesktop, dragLeft, 0}:  {doWorkspace, prev, "show the %s hidden workspace"},
+	{mouseDesktop, dragRight, 0}: {doWorkspace, next, "show the %s hidden workspace"},
+	{mouseDesktop, dragUp, 0}:    {doWindow, prev, "show the %s hidden window"},
+	{mouseDesktop, dragDown, 0}:  {doWindow, next, "show the %s hidden window"},
+
+	{mouseList, 1, 0}: {doList, listNone, "hide the list"},
+	{mouseList, 2, 0}: {doList, listNone, "hide the list"},
+	{mouseList, 3, 0}: {doList, listNone, "hide the list"},
+	{mouseList, 4, 0}: {doListScroll, -listScrollRows, "scroll the list up"},
+	{mouseList, 5, 0}: {doListScroll, +listScrollRows, "scroll the list down"},
+}
+
+// windowKeymap is a prefix keymap: after Caps Lock and Shift and the '}' key,
+// the next key, without Caps Lock, does one of these actions.
+var windowKeymap = &keymap{
+	name:  "window",
+	color: 0x3fbfff,
+	actions: map[int32]action{
+		+'c': {doWindowDelete, nil, "close the focused window"},
+		+'f': {doFullscreen, nil, "toggle fullscreen"},
+		+'h': {doHide, nil, "hide the focused window"},
+		+'k': {doWindowKill, nil, "kill the focused window"},
+		+'m': {doMerge, nil, "merge the focused frame"},
+		+'s': {doSplit, horizontal, "split the focused frame %s"},
+		+'v': {doSplit, vertical, "split the focused frame %s"},
+	},
+}
+
+// frameMode is a sticky keymap: after Caps Lock and Shift and the '{' key, and
+// until the Escape key, keys without Caps Lock do these actions or, for other
+// keys, the same as they do with Caps Lock.
+var frameMode = &keymap{
+	name:   "frame",
+	sticky: true,
+	color:  0xbf7fff,
+	actions: map[int32]action{
+		+'j': {doFrame, next, "focus the %s frame"},
+		+'k': {doFrame, prev, "focus the %s frame"},
+	},
 }
 
 // programAction is an action for a particular program to invoke, as opposed
@@ -40,13 +40,29 @@ Taowm is primarily keyboard driven, and all keyboard shortcuts involve first
 holding down the Caps Lock key, similar to how holding down the Control key
 followed by the 'N' key, in your web browser, creates a new browser window. The
 default Caps Lock behavior, CHANGING ALL TYPED LETTERS TO UPPER CASE, is
-disabled.
+disabled. With a non-Latin keyboard layout, such as Russian, the shortcuts use
+the keys of the first, usually Latin, layout.
 
 Caps Lock and the Space key will open a new web browser window. Caps Lock and
-the Enter key will open a new terminal emulator window. Caps Lock and the Shift
-key and the '|' pipe key will lock the screen. Caps Lock and the Backspace key
-will close the window in the focused frame. Caps Lock and the Tab key will
-cycle through the frames.
+the Enter key will open a new terminal emulator window. Caps Lock and Shift and
+the Enter key will show a list of programs to launch: type part of a program's
+name and press Enter. Programs launched more often are listed first. Caps Lock
+and the Shift key and the '|' pipe key will lock the screen. Caps Lock and the
+Backspace key will close the window in the focused frame. If that window's
+program does not respond, it is marked as not responding in the window list.
+Caps Lock and Shift and the Backspace key, or hitting Caps Lock and the
+Backspace key twice in quick succession, will kill it, and the frame border
+will flash red. For a window that can't be asked to close, the first press only
+flashes the frame border red, and a second press kills it. Caps Lock and the
+Tab key will cycle through the frames. Caps Lock and Shift and the '"' double
+quote key will list every keyboard shortcut and what it does: type part of a
+description to filter the list, and press Enter to perform that action. Caps
+Lock and Shift and the '}' key is a prefix: the next key, without Caps Lock,
+does a window action, such as 'S' or 'V' to split the frame or 'C' to close the
+window. Caps Lock and Shift and the '{' key starts frame mode: until the Escape
+key is pressed, keys work without Caps Lock, and 'J' and 'K' cycle through the
+frames. The focused frame's border changes color while a prefix or mode is
+active.
 
 To quit taowm and return to the log in screen, hold down Caps Lock and the
 Shift key and hit the Escape key three times in quick succession. Normally,
@@ -58,19 +74,29 @@ immediately, and the frame borders will turn red.
 If there are more windows than frames, then Caps Lock and the 'D' or 'F' key
 will cycle through hidden windows. Caps Lock and a number key like '1', '2',
 etc. will move the 1st, 2nd, etc. window to the focused frame. Caps Lock and
-the 'A' key will show a list of windows: the one currently in the focused
-frame is marked with a '+', other windows in other frames are marked with a
-'-', hidden windows that have not been seen yet are marked with an '@', and
-hidden windows that have been seen before are unmarked. In particular, newly
-created windows will not automatically be shown. Taowm prevents new windows
-from popping up and 'stealing' keyboard focus, a problem if the password you
-are typing into your terminal emulator accidentally gets written to a chat
-window that popped up at the wrong time. Instead, if there isn't an empty frame
-to accept a new window, taowm keeps that window hidden (and marked with an '@'
-in the window list) until you are ready to deal with it. If there are any such
+the 'A' key will show a list of windows: the one currently in the focused frame
+is marked with a '+', other windows in other frames are marked with a '-',
+hidden windows that have not been seen yet are marked with an '@', and hidden
+windows that have been seen before are unmarked. In particular, newly created
+windows will not automatically be shown. Taowm prevents new windows from
+popping up and 'stealing' keyboard focus, a problem if the password you are
+typing into your terminal emulator accidentally gets written to a chat window
+that popped up at the wrong time. Instead, if there isn't an empty frame to
+accept a new window, taowm keeps that window hidden (and marked with an '@' in
+the window list) until you are ready to deal with it. If there are any such
 windows that have not been seen yet, the green frame borders will pulsate to
 remind you. Selected windows are also marked with a '#'; selection is described
-below.
+below. Windows that ask for attention, such as a chat window receiving a
+message, are marked with a '!' and the frame borders will pulsate orange. Caps
+Lock and Shift and the '!' key will show the most recent such window, switching
+workspace if necessary. Long lists scroll with the mouse wheel. Caps Lock and
+Shift and the 'A' key will show the list of windows with a short label, such as
+"s" or "df", next to each window: typing a label moves that window to the
+focused frame. Caps Lock and Shift and the 'X' key does the same for the list
+of workspaces and their windows. Caps Lock and the '\' backslash key will
+search all windows in all workspaces: type part of a window's title or program
+name, use the Up and Down keys to choose a window and press Enter to go to it,
+or press Escape to cancel.
 
 Caps Lock and the 'G' key will toggle the focused frame in occupying the entire
 screen. Caps Lock and Shift and the 'G' key will hide the window in the focused
@@ -83,14 +109,28 @@ A screen contains workspaces like a frame contains windows. Caps Lock and the
 'E' or 'R' key will cycle through hidden workspaces. Caps Lock and Shift and
 the 'T' key will delete the current workspace, provided that it holds no
 windows and there is another hidden workspace to switch to. Caps Lock and the
-'Q' key will show a list of workspaces (and their windows). Caps Lock and the
-'`' key will cycle through the screens. Caps Lock and the F1 key, F2 key, etc.
-will move the 1st, 2nd, etc. workspace to the current screen. Caps Lock and the
-'S' key will select a window, or unselect a selected window. More than one
-window may be selected at a time. Caps Lock and Shift and the 'S' key will
-select or unselect all windows in the current workspace. Caps Lock and the 'W'
-key will migrate all selected windows to the current workspace and unselect
-them.
+'Q' key will show a list of workspaces (and their windows). Caps Lock and Shift
+and the 'Q' key will rename the current workspace: type the name and press
+Enter, or press Escape to cancel. Caps Lock and Shift and the 'W' key will
+prompt for a workspace name to go to. Caps Lock and the '`' key will cycle
+through the screens. Caps Lock and the '[' or ']' key will move the focused
+frame's window to the previous or next screen. Caps Lock and Shift and the '2'
+key, '3' key, etc. will move it to the 2nd, 3rd, etc. screen. Caps Lock and the
+F1 key, F2 key, etc. will move the 1st, 2nd, etc. workspace to the current
+screen. Caps Lock and Shift and the F1 key, F2 key, etc. will move the focused
+frame's window to the 1st, 2nd, etc. workspace, creating it if the workspace is
+just past the last one. Caps Lock and the 'S' key will select a window, or
+unselect a selected window. More than one window may be selected at a time.
+Caps Lock and Shift and the 'S' key will select or unselect all windows in the
+current workspace. Caps Lock and the 'W' key will migrate all selected windows
+to the current workspace and unselect them.
+
+The mouse can also be used, outside of windows. Clicking on an empty frame will
+show the list of windows, and right-clicking will show the list of workspaces.
+The mouse wheel, or middle-clicking, will cycle through hidden windows.
+Dragging the mouse left or right will cycle through hidden workspaces, and
+dragging up or down will cycle through hidden windows. These mouse bindings can
+be changed in config.go.
 
 Taowm also provides alternative ways to navigate within a program's window.
 Caps Lock and the 'H', 'J', 'K' or 'L' keys are equivalent to pressing the
@@ -10,43 +10,42 @@ import (
 	xp "github.com/BurntSushi/xgb/xproto"
 )
 
-var desktopColor uint32
-
-func setForeground(c uint32) {
-	if desktopColor == c {
+func (r *root) setForeground(c uint32) {
+	if r.desktopColor == c {
 		return
 	}
-	desktopColor = c
-	check(xp.ChangeGCChecked(xConn, desktopXGC, xp.GcForeground, []uint32{c}))
+	r.desktopColor = c
+	check(xp.ChangeGCChecked(xConn, r.desktopXGC, xp.GcForeground, []uint32{c}))
 }
 
-func drawText(x, y int16, text string) {
+func (r *root) drawText(x, y int16, text string) {
 	check(xp.ImageText8Checked(xConn, uint8(len(text)),
-		xp.Drawable(desktopXWin), desktopXGC, x, y, text))
+		xp.Drawable(r.desktopXWin), r.desktopXGC, x, y, text))
 }
 
 func clip(k *workspace) (int16, int16) {
-	r := k.focusedFrame.rect
-	if k.fullscreen || k.listing == listWorkspaces {
-		r = k.mainFrame.rect
-	}
+	r := k.listRect()
 	r.X, r.Y, r.Width, r.Height = r.X+2, r.Y+2, r.Width-3, r.Height-3
 	check(xp.SetClipRectanglesChecked(
-		xConn, xp.ClipOrderingUnsorted, desktopXGC, 0, 0, []xp.Rectangle{r}))
+		xConn, xp.ClipOrderingUnsorted, k.root.desktopXGC, 0, 0, []xp.Rectangle{r}))
 	return r.X, r.Y
 }
 
-func unclip() {
-	r := xp.Rectangle{X: 0, Y: 0, Width: desktopWidth, Height: desktopHeight}
+func (r *root) unclip() {
+	rect := xp.Rectangle{X: 0, Y: 0, Width: r.desktopWidth, Height: r.desktopHeight}
 	check(xp.SetClipRectanglesChecked(
-		xConn, xp.ClipOrderingUnsorted, desktopXGC, 0, 0, []xp.Rectangle{r}))
+		xConn, xp.ClipOrderingUnsorted, r.desktopXGC, 0, 0, []xp.Rectangle{rect}))
 }
 
 func handleExpose(e xp.ExposeEvent) {
 	if e.Count != 0 {
 		return
 	}
-	for _, s := range screens {
+	r := findRoot(func(r *root) bool { return r.desktopXWin == e.Window })
+	if r == nil {
+		return
+	}
+	for _, s := range r.screens {
 		k := s.workspace
 		k.drawFrameBorders()
 		if k.listing == listNone {
@@ -54,22 +53,61 @@ func handleExpose(e xp.ExposeEvent) {
 		}
 		x, y := clip(k)
 		y += int16(fontHeight1)
-		setForeground(colorPulseUnfocused)
-		info := time.Now().Format("2006-01-02  15:04  Monday")
-		if showBatteryPercentage {
-			info = fmt.Sprintf("Bat: %4s   %s", batteryPercentage(), info)
+		if typing != nil && typing.workspace == k {
+			r.setForeground(colorPulseFocused)
+			r.drawText(x, y, typing.prompt+typing.text+"_")
+		} else {
+			r.setForeground(colorPulseUnfocused)
+			info := time.Now().Format("2006-01-02  15:04  Monday")
+			if showBatteryPercentage {
+				info = fmt.Sprintf("Bat: %4s   %s", batteryPercentage(), info)
+			}
+			if rows, n := k.listRows(), len(k.list); n > rows {
+				last := k.scroll + rows
+				if last > n {
+					last = n
+				}
+				info = fmt.Sprintf("%s   (%d-%d of %d)", info, k.scroll+1, last, n)
+			}
+			r.drawText(x, y, info)
 		}
-		drawText(x, y, info)
 		y += int16(fontHeight)
 
-		if k.listing == listWindows {
-			setForeground(colorPulseFocused)
+		// visible is whether the i'th list item is within the overlay. The
+		// y co-ordinate of the i'th item is offset by the scroll amount.
+		y -= int16(k.scroll * fontHeight)
+		rows := k.listRows()
+		visible := func(i int) bool {
+			return k.scroll <= i && i < k.scroll+rows
+		}
+		// Items past the last hotkey, or all items when typing a hint, are
+		// labelled with their hint. Labels are padded to the widest one.
+		hinting := typing != nil && typing.workspace == k && typing.hints
+		hints := hintLabels(len(k.list))
+		wWidth, kWidth := 1, len(workspaceNames[0])
+		if len(hints) != 0 && wWidth < len(hints[0]) {
+			wWidth = len(hints[0])
+		}
+		if len(hints) != 0 && kWidth < len(hints[0]) {
+			kWidth = len(hints[0])
+		}
+
+		if k.listing == listWindows || k.listing == listSearch {
+			r.setForeground(colorPulseFocused)
 		}
 		wNum := 0
 		for i, item := range k.list {
 			if iw, ok := item.(*window); ok {
+				if !visible(i) {
+					if wNum < len(windowNames)-1 {
+						wNum++
+					}
+					continue
+				}
 				c0, c1 := ' ', ' '
-				if k.listing == listWindows {
+				if iw.urgent && iw.frame != k.focusedFrame {
+					c0 = '!'
+				} else if k.listing == listWindows || k.listing == listSearch {
 					if iw.frame == k.focusedFrame {
 						c0 = '+'
 					} else if iw.frame != nil {
@@ -81,8 +119,23 @@ func handleExpose(e xp.ExposeEvent) {
 				if iw.selected {
 					c1 = '#'
 				}
-				drawText(x+int16(3*fontWidth), y+int16(i*fontHeight),
-					fmt.Sprintf("%c%c %c %s", c0, c1, windowNames[wNum], iw.name))
+				name := iw.name
+				if iw.unresponsive {
+					name += "  (not responding)"
+				}
+				label := string(windowNames[wNum])
+				if hinting {
+					label = hints[i]
+				} else if k.listing == listSearch {
+					label = " "
+					if iw.class != "" {
+						name += "  [" + iw.class + "]"
+					}
+				} else if wNum == len(windowNames)-1 {
+					label = hints[i]
+				}
+				r.drawText(x+int16(3*fontWidth), y+int16(i*fontHeight),
+					fmt.Sprintf("%c%c %-*s %s", c0, c1, wWidth, label, name))
 				if wNum < len(windowNames)-1 {
 					wNum++
 				}
@@ -91,31 +144,63 @@ func handleExpose(e xp.ExposeEvent) {
 			}
 		}
 		if k.listing == listWorkspaces {
-			setForeground(colorPulseFocused)
+			r.setForeground(colorPulseFocused)
 			kNum := 0
 			for i, item := range k.list {
 				if ik, ok := item.(*workspace); ok {
+					if !visible(i) {
+						if kNum < len(workspaceNames)-1 {
+							kNum++
+						}
+						continue
+					}
 					c := ' '
 					if ik.screen == s {
 						c = '+'
 					} else if ik.screen != nil {
 						c = '-'
 					}
-					drawText(x+int16(3*fontWidth), y+int16(i*fontHeight),
-						fmt.Sprintf("%c  %s", c, workspaceNames[kNum]))
+					label := string(workspaceNames[kNum][:])
+					if hinting || kNum == len(workspaceNames)-1 {
+						label = hints[i]
+					}
+					r.drawText(x+int16(3*fontWidth), y+int16(i*fontHeight),
+						fmt.Sprintf("%c  %-*s  %s", c, kWidth, label, ik.name))
 					if kNum < len(workspaceNames)-1 {
 						kNum++
 					}
 				}
 			}
 		}
-		if k.index >= 0 {
-			drawText(x+int16(fontWidth), y+int16(k.index*fontHeight), ">")
+		if k.listing == listCommands {
+			r.setForeground(colorPulseFocused)
+			width := 0
+			for _, item := range k.list {
+				if ic, ok := item.(*command); ok && width < len(ic.name) {
+					width = len(ic.name)
+				}
+			}
+			if width > maxCommandNameWidth {
+				width = maxCommandNameWidth
+			}
+			for i, item := range k.list {
+				if ic, ok := item.(*command); ok && visible(i) {
+					r.drawText(x+int16(3*fontWidth), y+int16(i*fontHeight),
+						fmt.Sprintf("   %-*s  %s", width, ic.name, ic.detail))
+				}
+			}
+		}
+		if visible(k.index) {
+			r.drawText(x+int16(fontWidth), y+int16(k.index*fontHeight), ">")
 		}
-		unclip()
+		r.unclip()
 	}
 }
 
+// maxCommandNameWidth is the maximum width, in characters, of the column of
+// command names in a list of commands, such as programs to launch.
+const maxCommandNameWidth = 32
+
 var percentage = []byte("percentage:")
 
 func batteryPercentage() string {
@@ -187,24 +272,51 @@ func pulse() {
 		i = 0
 	}
 	anyUnseenWindows := findWindow(func(w *window) bool { return !w.seen }) != nil
-	if !anyUnseenWindows && i > len(cos)/2 {
+	anyUrgentWindows := findWindow(func(w *window) bool { return w.urgent }) != nil
+	if !anyUnseenWindows && !anyUrgentWindows && i > len(cos)/2 {
 		i = len(cos) / 2
 	}
 	if quitting {
 		colorFocused = colorQuitFocused
 		colorUnfocused = colorQuitUnfocused
+	} else if m := currentKeymap(); m != nil {
+		colorFocused = m.color
+		colorUnfocused = colorBaseUnfocused
+	} else if anyUrgentWindows {
+		colorFocused = blend(colorUrgentFocused, colorBaseFocused, uint32(i))
+		colorUnfocused = blend(colorUrgentUnfocused, colorBaseUnfocused, uint32(i))
 	} else {
 		colorFocused = blend(colorPulseFocused, colorBaseFocused, uint32(i))
 		colorUnfocused = blend(colorPulseUnfocused, colorBaseUnfocused, uint32(i))
 	}
-	for _, s := range screens {
-		s.workspace.drawFrameBorders()
-	}
-	if i < len(cos)/2 || anyUnseenWindows {
+	drawAllFrameBorders()
+	if i < len(cos)/2 || anyUnseenWindows || anyUrgentWindows {
 		pulseDoneChan <- struct{}{}
 	}
 }
 
+// flash briefly draws the frame's border in the quit color, to acknowledge
+// that its window is being killed.
+func flash(f *frame) {
+	k := f.workspace
+	if k.screen == nil || k.fullscreen || k.listing == listWorkspaces {
+		return
+	}
+	k.root.setForeground(colorQuitFocused)
+	f.drawBorder()
+	time.AfterFunc(flashDuration, func() {
+		proactiveChan <- drawAllFrameBorders
+	})
+}
+
+func drawAllFrameBorders() {
+	for _, r := range roots {
+		for _, s := range r.screens {
+			s.workspace.drawFrameBorders()
+		}
+	}
+}
+
 func blend(c0, c1, i uint32) uint32 {
 	x := uint32(cos[i%uint32(len(cos))])
 	y := 256 - x
@@ -262,6 +374,25 @@ var cos = [32]uint16{
 	254,
 }
 
+// hintLabels returns n distinct labels, built from hintChars, all of the same
+// length. Being the same length means that no label is a prefix of another, so
+// typing a label's characters unambiguously selects that label's list item.
+func hintLabels(n int) []string {
+	width, m := 1, len(hintChars)
+	for ; m < n; m *= len(hintChars) {
+		width++
+	}
+	labels := make([]string, n)
+	b := make([]byte, width)
+	for i := range labels {
+		for j, x := width-1, i; j >= 0; j, x = j-1, x/len(hintChars) {
+			b[j] = hintChars[x%len(hintChars)]
+		}
+		labels[i] = string(b)
+	}
+	return labels
+}
+
 var windowNames = [...]byte{
 	'1',
 	'2',
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHintLabels(t *testing.T) {
+	n := len(hintChars)
+	testCases := []struct {
+		n     int
+		width int
+	}{
+		{0, 1},
+		{1, 1},
+		{n, 1},
+		{n + 1, 2},
+		{n * n, 2},
+		{n*n + 1, 3},
+	}
+	for _, tc := range testCases {
+		labels := hintLabels(tc.n)
+		if len(labels) != tc.n {
+			t.Errorf("n=%d: got %d labels, want %d", tc.n, len(labels), tc.n)
+			continue
+		}
+		seen := map[string]bool{}
+		for _, l := range labels {
+			if len(l) != tc.width {
+				t.Errorf("n=%d: label %q: got width %d, want %d", tc.n, l, len(l), tc.width)
+			}
+			for i := 0; i < len(l); i++ {
+				if strings.IndexByte(hintChars, l[i]) < 0 {
+					t.Errorf("n=%d: label %q: %q is not a hint character", tc.n, l, l[i])
+				}
+			}
+			if seen[l] {
+				t.Errorf("n=%d: label %q is repeated", tc.n, l)
+			}
+			seen[l] = true
+		}
+	}
+	if got, want := strings.Join(hintLabels(3), " "), hintChars[:1]+" "+hintChars[1:2]+" "+hintChars[2:3]; got != want {
+		t.Errorf("hintLabels(3): got %q, want %q", got, want)
+	}
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"log"
+	"sort"
+	"strings"
+	"time"
 
 	xp "github.com/BurntSushi/xgb/xproto"
 )
@@ -21,12 +24,24 @@ const (
 	prev
 )
 
+type edge int
+
+const (
+	edgeLeft edge = iota
+	edgeRight
+	edgeTop
+	edgeBottom
+	nEdges
+)
+
 type listing int
 
 const (
 	listNone listing = iota
 	listWindows
 	listWorkspaces
+	listSearch
+	listCommands
 )
 
 // offscreenXY is a very negative X/Y co-ordinate. The most negative value is
@@ -44,43 +59,123 @@ func contains(r xp.Rectangle, x, y int16) bool {
 		r.Y <= y && y <= r.Y+int16(r.Height)
 }
 
-func screenContaining(x, y int16) *screen {
-	for _, s := range screens {
-		if contains(s.rect, x, y) {
+func (r *root) screenContaining(x, y int16) *screen {
+	for _, s := range r.screens {
+		if contains(s.bounds, x, y) {
 			return s
 		}
 	}
-	return screens[0]
+	return r.screens[0]
 }
 
-var (
-	screens        []*screen
-	dummyWorkspace workspace // The anchor of a doubly-linked list of workspaces.
-)
+var roots []*root
 
-func init() {
-	dummyWorkspace.link[next] = &dummyWorkspace
-	dummyWorkspace.link[prev] = &dummyWorkspace
+func findRoot(predicate func(*root) bool) *root {
+	for _, r := range roots {
+		if predicate(r) {
+			return r
+		}
+	}
+	return nil
+}
+
+// exists returns whether k is in its root's list of workspaces, as opposed to
+// having been deleted.
+func (k *workspace) exists() bool {
+	if k.root == nil {
+		return false
+	}
+	for k1 := k.root.dummyWorkspace.link[next]; k1 != &k.root.dummyWorkspace; k1 = k1.link[next] {
+		if k1 == k {
+			return true
+		}
+	}
+	return false
 }
 
 func findWindow(predicate func(*window) bool) *window {
-	for k := dummyWorkspace.link[next]; k != &dummyWorkspace; k = k.link[next] {
-		for w := k.dummyWindow.link[next]; w != &k.dummyWindow; w = w.link[next] {
-			if predicate(w) {
-				return w
+	for _, r := range roots {
+		for k := r.dummyWorkspace.link[next]; k != &r.dummyWorkspace; k = k.link[next] {
+			for w := k.dummyWindow.link[next]; w != &k.dummyWindow; w = w.link[next] {
+				if predicate(w) {
+					return w
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func findDock(xWin xp.Window) *dock {
+	for _, r := range roots {
+		for _, d := range r.docks {
+			if d.xWin == xWin {
+				return d
 			}
 		}
 	}
 	return nil
 }
 
+// root is an X screen, in the X11 protocol sense: a root window and taowm's
+// desktop window that covers it. Most X servers have only one root, even with
+// multiple monitors, but a "Zaphod mode" X server has one per monitor. Windows
+// cannot move from one root to another, so each root has its own screens,
+// docks and workspaces.
+type root struct {
+	xWin           xp.Window
+	desktopXWin    xp.Window
+	desktopXGC     xp.Gcontext
+	desktopColor   uint32
+	desktopWidth   uint16
+	desktopHeight  uint16
+	screens        []*screen
+	docks          []*dock
+	dummyWorkspace workspace // The anchor of a doubly-linked list of workspaces.
+
+	// monitorWorkspaces maps a screen's monitor to the workspace it last
+	// showed, so that a monitor that is unplugged and plugged back in gets
+	// the same workspace back.
+	monitorWorkspaces map[string]*workspace
+}
+
+func newRoot(xWin xp.Window) *root {
+	r := &root{
+		xWin:              xWin,
+		monitorWorkspaces: map[string]*workspace{},
+	}
+	r.dummyWorkspace.root = r
+	r.dummyWorkspace.link[next] = &r.dummyWorkspace
+	r.dummyWorkspace.link[prev] = &r.dummyWorkspace
+	return r
+}
+
+// screen is a physical monitor or, if configured in virtualScreens, part of
+// one. Its bounds is the entire monitor or, for a virtual screen, that part of
+// the monitor. Its rect is that part of its bounds not reserved by docks.
 type screen struct {
+	root      *root
 	workspace *workspace
+	name      string // The RandR output name, such as "HDMI-1", if known.
+	monitor   string // The output name and EDID identity, if known.
+	bounds    xp.Rectangle
 	rect      xp.Rectangle
 }
 
+// dock is a window, such as a status bar, whose _NET_WM_WINDOW_TYPE is
+// _NET_WM_WINDOW_TYPE_DOCK. Docks are shown where they ask to be and are never
+// framed. Instead, frames are laid out around them, avoiding the dock's
+// struts: the bands along the desktop's edges that the dock reserves.
+type dock struct {
+	root   *root
+	xWin   xp.Window
+	rect   xp.Rectangle
+	struts [nEdges]xp.Rectangle
+}
+
 type workspace struct {
 	link         [2]*workspace
+	root         *root
 	screen       *screen
 	focusedFrame *frame
 	mainFrame    frame
@@ -89,6 +184,8 @@ type workspace struct {
 	listing      listing
 	list         []interface{}
 	index        int
+	scroll       int    // The index of the first list item shown.
+	name         string // A user-assigned label, such as "mail", or "".
 }
 
 type frame struct {
@@ -103,6 +200,81 @@ type frame struct {
 	rect        xp.Rectangle
 }
 
+// sizeHints are a window's ICCCM WM_NORMAL_HINTS. Zero values mean no
+// constraint.
+type sizeHints struct {
+	minWidth, minHeight   int
+	maxWidth, maxHeight   int
+	incWidth, incHeight   int
+	baseWidth, baseHeight int
+	// minAspect and maxAspect are numerator/denominator pairs.
+	minAspect, maxAspect [2]int
+}
+
+// fit returns the largest rectangle that satisfies the size hints and is no
+// larger than r, centered within r. The area of r not covered by the result
+// shows the desktop background.
+func (h *sizeHints) fit(r xp.Rectangle) xp.Rectangle {
+	width, height := int(r.Width), int(r.Height)
+	if h.maxWidth > 0 && width > h.maxWidth {
+		width = h.maxWidth
+	}
+	if h.maxHeight > 0 && height > h.maxHeight {
+		height = h.maxHeight
+	}
+	if h.incWidth > 1 && width > h.baseWidth {
+		width -= (width - h.baseWidth) % h.incWidth
+	}
+	if h.incHeight > 1 && height > h.baseHeight {
+		height -= (height - h.baseHeight) % h.incHeight
+	}
+	// Per ICCCM 4.1.2.3, the aspect ratio limits apply to the size less the
+	// base size. Shrinking to meet them rounds down to the increments again.
+	if w, h0 := width-h.baseWidth, height-h.baseHeight; w > 0 && h0 > 0 {
+		if a := h.minAspect; a[0] > 0 && a[1] > 0 && w*a[1] < h0*a[0] {
+			h0 = w * a[1] / a[0]
+			if h.incHeight > 1 {
+				h0 -= h0 % h.incHeight
+			}
+			height = h.baseHeight + h0
+		}
+		if a := h.maxAspect; a[0] > 0 && a[1] > 0 && w*a[1] > h0*a[0] {
+			w = h0 * a[0] / a[1]
+			if h.incWidth > 1 {
+				w -= w % h.incWidth
+			}
+			width = h.baseWidth + w
+		}
+	}
+	// A minimum size larger than r is not honored, as the window would
+	// otherwise overlap other frames.
+	if width < h.minWidth {
+		width = h.minWidth
+	}
+	if height < h.minHeight {
+		height = h.minHeight
+	}
+	if width > int(r.Width) || width <= 0 {
+		width = int(r.Width)
+	}
+	if height > int(r.Height) || height <= 0 {
+		height = int(r.Height)
+	}
+	return xp.Rectangle{
+		X:      r.X + int16((int(r.Width)-width)/2),
+		Y:      r.Y + int16((int(r.Height)-height)/2),
+		Width:  uint16(width),
+		Height: uint16(height),
+	}
+}
+
+// wmStateXxx are the ICCCM WM_STATE values.
+const (
+	wmStateWithdrawn = 0
+	wmStateNormal    = 1
+	wmStateIconic    = 3
+)
+
 type window struct {
 	frame           *frame
 	link            [2]*window
@@ -110,21 +282,139 @@ type window struct {
 	xWin            xp.Window
 	rect            xp.Rectangle
 	name            string
+	class           string // The WM_CLASS instance name, such as "xterm".
 	offscreenSeqNum uint32
+	wmState         uint32
+	expectedUnmaps  int
+	sizeHints       sizeHints
 	hasTransientFor bool
 	seen            bool
 	selected        bool
+	urgent          bool
+	urgentSeqNum    uint32
+	unresponsive    bool
+	pingTime        time.Time
+	netWMPing       bool
 	wmDeleteWindow  bool
 	wmTakeFocus     bool
 }
 
 func (s *screen) repaint() {
-	check(xp.ClearAreaChecked(xConn, true, desktopXWin,
+	check(xp.ClearAreaChecked(xConn, true, s.root.desktopXWin,
 		s.rect.X, s.rect.Y, s.rect.Width+1, s.rect.Height+1))
 }
 
+// reserve returns r, an inclusive rectangle such as a screen's rect, shrunk so
+// that it no longer overlaps strut, an exclusive rectangle that is reserved
+// along r's edge e. If strut does not overlap r then r is returned unchanged.
+func reserve(r xp.Rectangle, e edge, strut xp.Rectangle) xp.Rectangle {
+	if strut.Width == 0 || strut.Height == 0 {
+		return r
+	}
+	// The x0, y0, x1 and y1 values are inclusive.
+	rx0, ry0 := int(r.X), int(r.Y)
+	rx1, ry1 := rx0+int(r.Width), ry0+int(r.Height)
+	sx0, sy0 := int(strut.X), int(strut.Y)
+	sx1, sy1 := sx0+int(strut.Width)-1, sy0+int(strut.Height)-1
+	if sx1 < rx0 || rx1 < sx0 || sy1 < ry0 || ry1 < sy0 {
+		return r
+	}
+	switch e {
+	case edgeLeft:
+		if rx0 < sx1+1 {
+			rx0 = sx1 + 1
+		}
+	case edgeRight:
+		if rx1 > sx0-1 {
+			rx1 = sx0 - 1
+		}
+	case edgeTop:
+		if ry0 < sy1+1 {
+			ry0 = sy1 + 1
+		}
+	case edgeBottom:
+		if ry1 > sy0-1 {
+			ry1 = sy0 - 1
+		}
+	}
+	if rx1 <= rx0 || ry1 <= ry0 {
+		// Don't let a dock reserve the entire rectangle.
+		return r
+	}
+	return xp.Rectangle{
+		X:      int16(rx0),
+		Y:      int16(ry0),
+		Width:  uint16(rx1 - rx0),
+		Height: uint16(ry1 - ry0),
+	}
+}
+
+// readStruts sets the dock's struts from its _NET_WM_STRUT_PARTIAL property,
+// falling back to its _NET_WM_STRUT property.
+func (d *dock) readStruts() {
+	v := cardinals(d.xWin, atomNetWMStrutPartial)
+	if len(v) < 12 {
+		v = cardinals(d.xWin, atomNetWMStrut)
+	}
+	d.setStruts(v)
+}
+
+// setStruts sets the dock's struts from the values of its
+// _NET_WM_STRUT_PARTIAL property or, if there are fewer than 12 values, its
+// _NET_WM_STRUT property. If there are too few values for either, then the
+// dock reserves its own rectangle: along the top or bottom edge if it is wider
+// than it is tall, otherwise along the left or right edge.
+func (d *dock) setStruts(v []uint32) {
+	d.struts = [nEdges]xp.Rectangle{}
+	if len(v) < 12 {
+		if len(v) >= 4 {
+			w, h := uint32(d.root.desktopWidth), uint32(d.root.desktopHeight)
+			v = append(v[:4:4], 0, h-1, 0, h-1, 0, w-1, 0, w-1)
+		} else {
+			v = nil
+		}
+	}
+	if v == nil {
+		dx, dy := 2*int(d.rect.X)+int(d.rect.Width), 2*int(d.rect.Y)+int(d.rect.Height)
+		switch {
+		case d.rect.Width < d.rect.Height && dx < int(d.root.desktopWidth):
+			d.struts[edgeLeft] = d.rect
+		case d.rect.Width < d.rect.Height:
+			d.struts[edgeRight] = d.rect
+		case dy < int(d.root.desktopHeight):
+			d.struts[edgeTop] = d.rect
+		default:
+			d.struts[edgeBottom] = d.rect
+		}
+		return
+	}
+	span := func(start, end uint32) (int16, uint16) {
+		if end < start {
+			return 0, 0
+		}
+		return int16(start), uint16(end - start + 1)
+	}
+	if n := v[0]; n != 0 {
+		d.struts[edgeLeft].Y, d.struts[edgeLeft].Height = span(v[4], v[5])
+		d.struts[edgeLeft].X, d.struts[edgeLeft].Width = 0, uint16(n)
+	}
+	if n := v[1]; n != 0 {
+		d.struts[edgeRight].Y, d.struts[edgeRight].Height = span(v[6], v[7])
+		d.struts[edgeRight].X, d.struts[edgeRight].Width = int16(uint32(d.root.desktopWidth)-n), uint16(n)
+	}
+	if n := v[2]; n != 0 {
+		d.struts[edgeTop].X, d.struts[edgeTop].Width = span(v[8], v[9])
+		d.struts[edgeTop].Y, d.struts[edgeTop].Height = 0, uint16(n)
+	}
+	if n := v[3]; n != 0 {
+		d.struts[edgeBottom].X, d.struts[edgeBottom].Width = span(v[10], v[11])
+		d.struts[edgeBottom].Y, d.struts[edgeBottom].Height = int16(uint32(d.root.desktopHeight)-n), uint16(n)
+	}
+}
+
 func newWorkspace(rect xp.Rectangle, previous *workspace) *workspace {
 	k := &workspace{
+		root: previous.root,
 		mainFrame: frame{
 			rect: rect,
 		},
@@ -141,70 +431,250 @@ func newWorkspace(rect xp.Rectangle, previous *workspace) *workspace {
 	k.link[prev].link[next] = k
 
 	k.mainFrame.split(horizontal)
+	k.name = k.root.unusedDefaultName()
 	return k
 }
 
+// unusedDefaultName returns the first of the defaultWorkspaceNames that isn't
+// already the name of one of the root's workspaces, or "" if they all are.
+func (r *root) unusedDefaultName() string {
+loop:
+	for _, name := range defaultWorkspaceNames {
+		for k := r.dummyWorkspace.link[next]; k != &r.dummyWorkspace; k = k.link[next] {
+			if k.name == name {
+				continue loop
+			}
+		}
+		return name
+	}
+	return ""
+}
+
+// findWorkspaceNamed returns the root's workspace with the given name or, if
+// there is no such workspace, the first workspace whose name starts with it.
+// The comparison is case-insensitive.
+func (r *root) findWorkspaceNamed(name string) *workspace {
+	if name == "" {
+		return nil
+	}
+	name = strings.ToLower(name)
+	prefixed := (*workspace)(nil)
+	for k := r.dummyWorkspace.link[next]; k != &r.dummyWorkspace; k = k.link[next] {
+		kName := strings.ToLower(k.name)
+		if kName == name {
+			return k
+		}
+		if prefixed == nil && strings.HasPrefix(kName, name) {
+			prefixed = k
+		}
+	}
+	return prefixed
+}
+
 func makeLists() {
-	for _, s := range screens {
-		if s.workspace.listing != listNone {
-			s.workspace.makeList()
+	for _, r := range roots {
+		for _, s := range r.screens {
+			if s.workspace.listing != listNone {
+				s.workspace.makeList()
+			}
 		}
 	}
 }
 
 func (k *workspace) makeList() {
+	k.fillList()
+	k.index = -1
+	if k.listing == listSearch || k.listing == listCommands {
+		// The cursor starts on the best match, not where the pointer is.
+		if len(k.list) != 0 {
+			k.setIndex(0)
+		}
+	} else if len(k.list) != 0 {
+		if p, err := xp.QueryPointer(xConn, k.root.xWin).Reply(); err != nil {
+			log.Println(err)
+		} else if p != nil {
+			k.index = k.indexForPoint(p.RootX, p.RootY)
+		}
+	}
+	k.configure()
+	k.screen.repaint()
+}
+
+// refreshList rebuilds the list overlay, such as after a window is renamed,
+// keeping the cursor on the same item and the list scrolled where it was.
+func (k *workspace) refreshList() {
+	var selected interface{}
+	if 0 <= k.index && k.index < len(k.list) {
+		selected = k.list[k.index]
+	}
+	k.fillList()
+	k.index = -1
+	for i, item := range k.list {
+		if item == selected {
+			k.setIndex(i)
+			break
+		}
+	}
+	if k.index < 0 && len(k.list) != 0 && (k.listing == listSearch || k.listing == listCommands) {
+		k.setIndex(0)
+	}
+	k.configure()
+	k.screen.repaint()
+}
+
+// fillList sets the list overlay's items for its listing.
+func (k *workspace) fillList() {
 	switch k.listing {
 	case listWindows:
 		k.list = k.makeWindowList()
 	case listWorkspaces:
 		k.list = k.makeWorkspaceList()
+	case listSearch:
+		text := ""
+		if typing != nil && typing.workspace == k {
+			text = typing.text
+		}
+		k.list = k.makeSearchList(text)
+	case listCommands:
+		if typing != nil && typing.workspace == k {
+			k.list = makeCommandList(typing.commands, typing.text)
+		} else {
+			k.list = nil
+		}
 	default:
 		k.list = nil
-	}
-	k.index = -1
-	if len(k.list) != 0 {
-		if p, err := xp.QueryPointer(xConn, rootXWin).Reply(); err != nil {
-			log.Println(err)
-		} else if p != nil {
-			k.index = k.indexForPoint(p.RootX, p.RootY)
+		if typing != nil && typing.workspace == k {
+			stopTyping()
 		}
 	}
-	k.configure()
-	k.screen.repaint()
+	k.clampScroll()
 }
 
 func (k *workspace) makeWindowList() (list []interface{}) {
 	for w := k.dummyWindow.link[next]; w != &k.dummyWindow; w = w.link[next] {
-		// TODO: listen instead of poll for name changes.
-		w.name = w.property(atomNetWMName)
-		if w.name == "" {
-			w.name = "?"
-		}
 		list = append(list, w)
 	}
 	return list
 }
 
 func (k *workspace) makeWorkspaceList() (list []interface{}) {
-	for k := dummyWorkspace.link[next]; k != &dummyWorkspace; k = k.link[next] {
+	r := k.root
+	for k := r.dummyWorkspace.link[next]; k != &r.dummyWorkspace; k = k.link[next] {
 		list = append(list, k)
 		list = append(list, k.makeWindowList()...)
 	}
 	return list
 }
 
-func (k *workspace) indexForPoint(rootX, rootY int16) int {
-	r := k.focusedFrame.rect
+// makeSearchList returns the windows, in all of the root's workspaces, whose
+// name or class fuzzily match the text, best match first.
+func (k *workspace) makeSearchList(text string) (list []interface{}) {
+	type match struct {
+		w     *window
+		score int
+	}
+	var matches []match
+	r := k.root
+	for k1 := r.dummyWorkspace.link[next]; k1 != &r.dummyWorkspace; k1 = k1.link[next] {
+		for w := k1.dummyWindow.link[next]; w != &k1.dummyWindow; w = w.link[next] {
+			if score, ok := fuzzyMatch(text, w.name+" "+w.class); ok {
+				matches = append(matches, match{w, score})
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+	for _, m := range matches {
+		list = append(list, m.w)
+	}
+	return list
+}
+
+// fuzzyMatch returns whether the pattern's characters occur in order, ignoring
+// case, in s. The score is lower for better matches: those whose characters
+// are close together and near the start of s.
+func fuzzyMatch(pattern, s string) (score int, ok bool) {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	last := -1
+	for i := 0; i < len(pattern); i++ {
+		j := strings.IndexByte(s[last+1:], pattern[i])
+		if j < 0 {
+			return 0, false
+		}
+		if last < 0 {
+			score += j
+		} else {
+			// Gaps between matched characters cost more than an offset
+			// from the start.
+			score += 2 * j
+		}
+		last += 1 + j
+	}
+	return score, true
+}
+
+// listRect returns the rectangle that the list overlay is drawn in.
+func (k *workspace) listRect() xp.Rectangle {
 	if k.fullscreen || k.listing == listWorkspaces {
-		r = k.mainFrame.rect
+		return k.mainFrame.rect
+	}
+	return k.focusedFrame.rect
+}
+
+// listRows returns how many list items fit in the list overlay, below the
+// first line of text that shows the date and time.
+func (k *workspace) listRows() int {
+	if n := int(k.listRect().Height)/fontHeight - 1; n > 1 {
+		return n
+	}
+	return 1
+}
+
+// clampScroll ensures that the list overlay shows as many items as possible.
+func (k *workspace) clampScroll() {
+	if max := len(k.list) - k.listRows(); k.scroll > max {
+		k.scroll = max
+	}
+	if k.scroll < 0 {
+		k.scroll = 0
 	}
+}
+
+// scrollList scrolls the list overlay by delta items.
+func (k *workspace) scrollList(delta int) {
+	k.scroll += delta
+	k.clampScroll()
+}
+
+// setIndex sets the list overlay's cursor, scrolling the list if necessary so
+// that the cursor is shown.
+func (k *workspace) setIndex(i int) {
+	k.index = i
+	if i < 0 {
+		return
+	}
+	if rows := k.listRows(); i >= k.scroll+rows {
+		k.scroll = i - rows + 1
+	}
+	if i < k.scroll {
+		k.scroll = i
+	}
+}
+
+func (k *workspace) indexForPoint(rootX, rootY int16) int {
+	r := k.listRect()
 	x := int(rootX - r.X)
 	y := int(rootY - r.Y)
 	if x <= 0 || int(r.Width) <= x || y <= 0 || int(r.Height) <= y {
 		return -1
 	}
 	i := int(y/fontHeight) - 1
-	if i < 0 || len(k.list) <= i {
+	if i < 0 || k.listRows() <= i {
+		return -1
+	}
+	i += k.scroll
+	if len(k.list) <= i {
 		return -1
 	}
 	if k.listing == listWorkspaces {
@@ -217,6 +687,18 @@ func (k *workspace) indexForPoint(rootX, rootY int16) int {
 	return i
 }
 
+// followPointer returns the list overlay's cursor for the mouse pointer at the
+// point. A stray mouse movement shouldn't change what the Return key chooses,
+// so when typing, the pointer is only followed while it is over the list and
+// before any filter text is typed.
+func (k *workspace) followPointer(rootX, rootY int16) int {
+	i := k.indexForPoint(rootX, rootY)
+	if typing != nil && typing.workspace == k && (i < 0 || typing.text != "") {
+		return k.index
+	}
+	return i
+}
+
 func (k *workspace) configure() {
 	for w := k.dummyWindow.link[next]; w != &k.dummyWindow; w = w.link[next] {
 		w.configure()
@@ -227,10 +709,11 @@ func (k *workspace) drawFrameBorders() {
 	if k.fullscreen || k.listing == listWorkspaces {
 		return
 	}
-	setForeground(colorUnfocused)
+	r := k.root
+	r.setForeground(colorUnfocused)
 	rects := k.mainFrame.appendRectangles(nil)
-	check(xp.PolyRectangleChecked(xConn, xp.Drawable(desktopXWin), desktopXGC, rects))
-	setForeground(colorFocused)
+	check(xp.PolyRectangleChecked(xConn, xp.Drawable(r.desktopXWin), r.desktopXGC, rects))
+	r.setForeground(colorFocused)
 	k.focusedFrame.drawBorder()
 }
 
@@ -240,9 +723,9 @@ func (k *workspace) focusFrame(f *frame) {
 	}
 	if k.focusedFrame != f {
 		if !k.fullscreen && k.listing != listWorkspaces {
-			setForeground(colorUnfocused)
+			k.root.setForeground(colorUnfocused)
 			k.focusedFrame.drawBorder()
-			setForeground(colorFocused)
+			k.root.setForeground(colorFocused)
 			f.drawBorder()
 		}
 		k.focusedFrame = f
@@ -251,7 +734,7 @@ func (k *workspace) focusFrame(f *frame) {
 	if k.listing != listNone {
 		w = nil
 	}
-	focus(w)
+	focus(k.root, w)
 }
 
 func (k *workspace) frameContaining(x, y int16) *frame {
@@ -311,6 +794,20 @@ func (f *frame) firstEmptyFrame() *frame {
 	return nil
 }
 
+// hasDescendent returns whether d is f or is in f's tree of frames, as opposed
+// to having been merged away.
+func (f *frame) hasDescendent(d *frame) bool {
+	if f == d {
+		return true
+	}
+	for c := f.firstChild; c != nil; c = c.nextSibling {
+		if c.hasDescendent(d) {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *frame) numChildren() (n int) {
 	for c := f.firstChild; c != nil; c = c.nextSibling {
 		n++
@@ -444,11 +941,23 @@ func (f *frame) traverse(t traversal) *frame {
 }
 
 func (f *frame) drawBorder() {
-	check(xp.PolyRectangleChecked(xConn, xp.Drawable(desktopXWin), desktopXGC,
+	r := f.workspace.root
+	check(xp.PolyRectangleChecked(xConn, xp.Drawable(r.desktopXWin), r.desktopXGC,
 		[]xp.Rectangle{f.rect}))
 }
 
-var nextOffscreenSeqNum uint32 = 1
+var (
+	nextOffscreenSeqNum uint32 = 1
+	nextUrgentSeqNum    uint32 = 1
+)
+
+// readClass reads the first of the two null-terminated strings in WM_CLASS.
+func (w *window) readClass() {
+	w.class = w.property(atomWMClass)
+	if i := strings.IndexByte(w.class, '\x00'); i >= 0 {
+		w.class = w.class[:i]
+	}
+}
 
 func (w *window) property(a xp.Atom) string {
 	p, err := xp.GetProperty(xConn, false, w.xWin, a, xp.GetPropertyTypeAny, 0, 1<<32-1).Reply()
@@ -461,13 +970,113 @@ func (w *window) property(a xp.Atom) string {
 	return string(p.Value)
 }
 
+// workspace returns the workspace whose list of windows contains w.
+func (w *window) workspace() *workspace {
+	for _, r := range roots {
+		for k := r.dummyWorkspace.link[next]; k != &r.dummyWorkspace; k = k.link[next] {
+			for w1 := k.dummyWindow.link[next]; w1 != &k.dummyWindow; w1 = w1.link[next] {
+				if w1 == w {
+					return k
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// unmap unmaps the window without withdrawing it: taowm continues to manage
+// the window, unlike when a client unmaps its own window.
+func (w *window) unmap() {
+	w.expectedUnmaps++
+	check(xp.UnmapWindowChecked(xConn, w.xWin))
+}
+
+// readName sets the window's name from its _NET_WM_NAME property, falling back
+// to its WM_NAME property. It returns whether the name changed.
+func (w *window) readName() bool {
+	name := w.property(atomNetWMName)
+	if name == "" {
+		p, err := xp.GetProperty(xConn, false, w.xWin, atomWMName,
+			xp.GetPropertyTypeAny, 0, 1<<32-1).Reply()
+		if err != nil {
+			log.Println(err)
+		} else if p != nil {
+			switch p.Type {
+			case atomCompoundText:
+				name = decodeCompoundText(p.Value)
+			case xp.AtomString:
+				name = decodeLatin1(p.Value)
+			default:
+				name = string(p.Value)
+			}
+		}
+	}
+	if name == "" {
+		name = "?"
+	}
+	if w.name == name {
+		return false
+	}
+	w.name = name
+	return true
+}
+
+// decodeLatin1 converts ISO 8859-1 encoded text to UTF-8.
+func decodeLatin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// decodeCompoundText converts COMPOUND_TEXT encoded text to UTF-8. It only
+// understands UTF-8 and ISO 8859-1 segments. Other character sets' segments are
+// decoded as if they were ISO 8859-1.
+func decodeCompoundText(b []byte) string {
+	const esc = 0x1b
+	out, utf8 := []byte(nil), false
+	for len(b) > 0 {
+		if b[0] != esc {
+			i := 0
+			for i < len(b) && b[i] != esc {
+				i++
+			}
+			if utf8 {
+				out = append(out, b[:i]...)
+			} else {
+				out = append(out, decodeLatin1(b[:i])...)
+			}
+			b = b[i:]
+			continue
+		}
+		// An escape sequence is ESC, zero or more intermediate bytes in the
+		// range 0x20-0x2f and a final byte in the range 0x30-0x7e.
+		i := 1
+		for i < len(b) && 0x20 <= b[i] && b[i] <= 0x2f {
+			i++
+		}
+		if i < len(b) {
+			i++
+		}
+		switch string(b[1:i]) {
+		case "%G":
+			utf8 = true
+		case "%@", "(B", "-A":
+			utf8 = false
+		}
+		b = b[i:]
+	}
+	return string(out)
+}
+
 func (w *window) configure() {
 	mask, values := uint16(0), []uint32(nil)
 	r := xp.Rectangle{X: offscreenXY, Y: offscreenXY, Width: w.rect.Width, Height: w.rect.Height}
 	if w.frame != nil && w.frame.workspace.screen != nil {
 		k := w.frame.workspace
 		if k.listing == listWorkspaces ||
-			(k.listing == listWindows && k.focusedFrame == w.frame) {
+			(k.listing != listNone && k.focusedFrame == w.frame) {
 			// No-op; r is offscreen.
 		} else if k.fullscreen {
 			if k.focusedFrame == w.frame {
@@ -483,12 +1092,16 @@ func (w *window) configure() {
 			r.Height = w.frame.rect.Height - 3
 		}
 	}
+	if r.X != offscreenXY {
+		r = w.sizeHints.fit(r)
+	}
 	if w.seen && w.rect == r {
 		return
 	}
 	w.rect = r
 	if r.X != offscreenXY {
 		w.seen = true
+		w.setWMState(wmStateNormal)
 		mask = xp.ConfigWindowX |
 			xp.ConfigWindowY |
 			xp.ConfigWindowWidth |
@@ -504,6 +1117,7 @@ func (w *window) configure() {
 	} else {
 		w.offscreenSeqNum = nextOffscreenSeqNum
 		nextOffscreenSeqNum++
+		w.setWMState(wmStateIconic)
 		mask = xp.ConfigWindowX | xp.ConfigWindowY
 		values = []uint32{
 			uint32(uint16(r.X)),
@@ -512,3 +1126,101 @@ func (w *window) configure() {
 	}
 	check(xp.ConfigureWindowChecked(xConn, w.xWin, mask, values))
 }
+
+// setWMState sets the window's ICCCM WM_STATE property. Taowm hides windows by
+// moving them offscreen instead of unmapping them, so other programs can use
+// the Iconic state to tell that such windows aren't visible.
+func (w *window) setWMState(state uint32) {
+	if w.wmState == state {
+		return
+	}
+	w.wmState = state
+	if state == wmStateWithdrawn {
+		check(xp.DeletePropertyChecked(xConn, w.xWin, atomWMState))
+		return
+	}
+	// The second value is the icon window, of which there is none.
+	b := []byte{
+		byte(state >> 0),
+		byte(state >> 8),
+		byte(state >> 16),
+		byte(state >> 24),
+		0, 0, 0, 0,
+	}
+	check(xp.ChangePropertyChecked(xConn, xp.PropModeReplace, w.xWin,
+		atomWMState, atomWMState, 32, 2, b))
+}
+
+// readSizeHints sets the window's sizeHints from its WM_NORMAL_HINTS property.
+func (w *window) readSizeHints() {
+	const (
+		pMinSize   = 1 << 4
+		pMaxSize   = 1 << 5
+		pResizeInc = 1 << 6
+		pAspect    = 1 << 7
+		pBaseSize  = 1 << 8
+	)
+	w.sizeHints = sizeHints{}
+	v := cardinals(w.xWin, atomWMNormalHints)
+	if len(v) < 15 {
+		return
+	}
+	h, flags := &w.sizeHints, v[0]
+	if flags&pMinSize != 0 {
+		h.minWidth, h.minHeight = int(v[5]), int(v[6])
+	}
+	if flags&pMaxSize != 0 {
+		h.maxWidth, h.maxHeight = int(v[7]), int(v[8])
+	}
+	if flags&pResizeInc != 0 {
+		h.incWidth, h.incHeight = int(v[9]), int(v[10])
+	}
+	if flags&pAspect != 0 {
+		h.minAspect = [2]int{int(v[11]), int(v[12])}
+		h.maxAspect = [2]int{int(v[13]), int(v[14])}
+	}
+	// As per the ICCCM, the base size defaults to the minimum size and vice
+	// versa.
+	if flags&pBaseSize != 0 && len(v) >= 17 {
+		h.baseWidth, h.baseHeight = int(v[15]), int(v[16])
+		if flags&pMinSize == 0 {
+			h.minWidth, h.minHeight = h.baseWidth, h.baseHeight
+		}
+	} else {
+		h.baseWidth, h.baseHeight = h.minWidth, h.minHeight
+	}
+}
+
+// readUrgency sets whether the window is urgent from its WM_HINTS and
+// _NET_WM_STATE properties.
+func (w *window) readUrgency() {
+	const xUrgencyHint = 1 << 8
+	urgent := false
+	if v := cardinals(w.xWin, atomWMHints); len(v) > 0 && v[0]&xUrgencyHint != 0 {
+		urgent = true
+	}
+	for _, a := range cardinals(w.xWin, atomNetWMState) {
+		if xp.Atom(a) == atomNetWMStateDemandsAttention {
+			urgent = true
+		}
+	}
+	w.setUrgent(urgent)
+}
+
+// setUrgent sets whether the window is asking for attention. The focused
+// window is never urgent, as it already has the user's attention.
+func (w *window) setUrgent(urgent bool) {
+	if urgent && w.xWin == previousFocusXWin {
+		urgent = false
+	}
+	if w.urgent == urgent {
+		return
+	}
+	w.urgent = urgent
+	if urgent {
+		w.urgentSeqNum = nextUrgentSeqNum
+		nextUrgentSeqNum++
+		pulseChan <- time.Now()
+	}
+	makeLists()
+}
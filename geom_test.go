@@ -0,0 +1,261 @@
+package main
+
+import (
+	"testing"
+
+	xp "github.com/BurntSushi/xgb/xproto"
+)
+
+func TestReserve(t *testing.T) {
+	r := xp.Rectangle{X: 0, Y: 0, Width: 1000, Height: 800}
+	testCases := []struct {
+		e     edge
+		strut xp.Rectangle
+		want  xp.Rectangle
+	}{
+		{edgeLeft, xp.Rectangle{}, r},
+		{edgeLeft, xp.Rectangle{X: 0, Y: 0, Width: 50, Height: 800}, xp.Rectangle{X: 50, Y: 0, Width: 950, Height: 800}},
+		{edgeRight, xp.Rectangle{X: 950, Y: 0, Width: 50, Height: 800}, xp.Rectangle{X: 0, Y: 0, Width: 949, Height: 800}},
+		{edgeTop, xp.Rectangle{X: 0, Y: 0, Width: 1000, Height: 30}, xp.Rectangle{X: 0, Y: 30, Width: 1000, Height: 770}},
+		{edgeBottom, xp.Rectangle{X: 0, Y: 770, Width: 1000, Height: 30}, xp.Rectangle{X: 0, Y: 0, Width: 1000, Height: 769}},
+		// A strut on another monitor doesn't affect this one.
+		{edgeLeft, xp.Rectangle{X: 2000, Y: 0, Width: 50, Height: 800}, r},
+		// A dock can't reserve the entire rectangle.
+		{edgeTop, xp.Rectangle{X: 0, Y: 0, Width: 1000, Height: 800}, r},
+	}
+	for _, tc := range testCases {
+		if got := reserve(r, tc.e, tc.strut); got != tc.want {
+			t.Errorf("reserve(%v, %d, %v): got %v, want %v", r, tc.e, tc.strut, got, tc.want)
+		}
+	}
+}
+
+func TestSetStruts(t *testing.T) {
+	testCases := []struct {
+		desc string
+		rect xp.Rectangle
+		v    []uint32
+		e    edge
+		want xp.Rectangle
+	}{{
+		desc: "partial left",
+		v:    []uint32{40, 0, 0, 0, 100, 299, 0, 0, 0, 0, 0, 0},
+		e:    edgeLeft,
+		want: xp.Rectangle{X: 0, Y: 100, Width: 40, Height: 200},
+	}, {
+		desc: "partial bottom",
+		v:    []uint32{0, 0, 0, 30, 0, 0, 0, 0, 0, 0, 0, 999},
+		e:    edgeBottom,
+		want: xp.Rectangle{X: 0, Y: 770, Width: 1000, Height: 30},
+	}, {
+		desc: "strut top",
+		v:    []uint32{0, 0, 25, 0},
+		e:    edgeTop,
+		want: xp.Rectangle{X: 0, Y: 0, Width: 1000, Height: 25},
+	}, {
+		desc: "strut right",
+		v:    []uint32{0, 60, 0, 0},
+		e:    edgeRight,
+		want: xp.Rectangle{X: 940, Y: 0, Width: 60, Height: 800},
+	}, {
+		desc: "no struts, wide at the top",
+		rect: xp.Rectangle{X: 0, Y: 0, Width: 1000, Height: 20},
+		e:    edgeTop,
+		want: xp.Rectangle{X: 0, Y: 0, Width: 1000, Height: 20},
+	}, {
+		desc: "no struts, tall at the right",
+		rect: xp.Rectangle{X: 980, Y: 0, Width: 20, Height: 800},
+		e:    edgeRight,
+		want: xp.Rectangle{X: 980, Y: 0, Width: 20, Height: 800},
+	}}
+	for _, tc := range testCases {
+		d := &dock{
+			root: &root{desktopWidth: 1000, desktopHeight: 800},
+			rect: tc.rect,
+		}
+		d.setStruts(tc.v)
+		for e := edge(0); e < nEdges; e++ {
+			want := xp.Rectangle{}
+			if e == tc.e {
+				want = tc.want
+			}
+			if got := d.struts[e]; got != want {
+				t.Errorf("%s: edge %d: got %v, want %v", tc.desc, e, got, want)
+			}
+		}
+	}
+}
+
+func TestSizeHintsFit(t *testing.T) {
+	testCases := []struct {
+		desc string
+		h    sizeHints
+		r    xp.Rectangle
+		want xp.Rectangle
+	}{{
+		desc: "no hints",
+		r:    xp.Rectangle{X: 10, Y: 20, Width: 800, Height: 600},
+		want: xp.Rectangle{X: 10, Y: 20, Width: 800, Height: 600},
+	}, {
+		desc: "max size",
+		h:    sizeHints{maxWidth: 400, maxHeight: 300},
+		r:    xp.Rectangle{X: 0, Y: 0, Width: 800, Height: 600},
+		want: xp.Rectangle{X: 200, Y: 150, Width: 400, Height: 300},
+	}, {
+		desc: "increments",
+		h:    sizeHints{baseWidth: 10, baseHeight: 10, incWidth: 7, incHeight: 13},
+		r:    xp.Rectangle{X: 0, Y: 0, Width: 100, Height: 100},
+		want: xp.Rectangle{X: 3, Y: 6, Width: 94, Height: 88},
+	}, {
+		desc: "min size larger than the frame",
+		h:    sizeHints{minWidth: 200, minHeight: 200},
+		r:    xp.Rectangle{X: 0, Y: 0, Width: 100, Height: 100},
+		want: xp.Rectangle{X: 0, Y: 0, Width: 100, Height: 100},
+	}, {
+		desc: "min aspect",
+		h:    sizeHints{minAspect: [2]int{2, 1}},
+		r:    xp.Rectangle{X: 0, Y: 0, Width: 100, Height: 100},
+		want: xp.Rectangle{X: 0, Y: 25, Width: 100, Height: 50},
+	}, {
+		desc: "max aspect",
+		h:    sizeHints{maxAspect: [2]int{1, 2}},
+		r:    xp.Rectangle{X: 0, Y: 0, Width: 100, Height: 100},
+		want: xp.Rectangle{X: 25, Y: 0, Width: 50, Height: 100},
+	}, {
+		desc: "aspect less the base size",
+		h:    sizeHints{baseWidth: 20, baseHeight: 20, minAspect: [2]int{2, 1}},
+		r:    xp.Rectangle{X: 0, Y: 0, Width: 100, Height: 100},
+		want: xp.Rectangle{X: 0, Y: 20, Width: 100, Height: 60},
+	}, {
+		desc: "aspect after increments",
+		h:    sizeHints{incWidth: 7, incHeight: 7, maxAspect: [2]int{1, 2}},
+		r:    xp.Rectangle{X: 0, Y: 0, Width: 100, Height: 100},
+		want: xp.Rectangle{X: 25, Y: 1, Width: 49, Height: 98},
+	}}
+	for _, tc := range testCases {
+		if got := tc.h.fit(tc.r); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeLatin1(t *testing.T) {
+	testCases := []struct {
+		in   []byte
+		want string
+	}{
+		{nil, ""},
+		{[]byte("xterm"), "xterm"},
+		{[]byte("caf\xe9"), "café"},
+		{[]byte("\xbfqu\xe9?"), "¿qué?"},
+	}
+	for _, tc := range testCases {
+		if got := decodeLatin1(tc.in); got != tc.want {
+			t.Errorf("decodeLatin1(%q): got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeCompoundText(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		// Without an escape sequence, compound text is Latin-1.
+		{"caf\xe9", "café"},
+		{"\x1b%Gcaf\xc3\xa9", "café"},
+		{"\x1b%G\xe2\x98\x83\x1b%@ caf\xe9", "☃ café"},
+		{"\x1b(Bcaf\x1b-A\xe9", "café"},
+		// An unknown character set's escape sequence is skipped.
+		{"a\x1b$(Bb", "ab"},
+	}
+	for _, tc := range testCases {
+		if got := decodeCompoundText([]byte(tc.in)); got != tc.want {
+			t.Errorf("decodeCompoundText(%q): got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	testCases := []struct {
+		pattern, s string
+		score      int
+		ok         bool
+	}{
+		{"", "anything", 0, true},
+		{"term", "Terminal", 0, true},
+		{"TERM", "terminal", 0, true},
+		{"min", "Terminal", 3, true},
+		{"tml", "Terminal", 10, true},
+		{"chr", "Google Chrome", 7, true},
+		{"xyz", "Terminal", 0, false},
+		{"lt", "Terminal", 0, false},
+		{"terminals", "Terminal", 0, false},
+	}
+	for _, tc := range testCases {
+		score, ok := fuzzyMatch(tc.pattern, tc.s)
+		if score != tc.score || ok != tc.ok {
+			t.Errorf("fuzzyMatch(%q, %q): got %d, %t, want %d, %t",
+				tc.pattern, tc.s, score, ok, tc.score, tc.ok)
+		}
+	}
+
+	// Closer and earlier matches score better.
+	a, _ := fuzzyMatch("ch", "chrome")
+	b, _ := fuzzyMatch("ch", "xchat")
+	c, _ := fuzzyMatch("ch", "cache")
+	if !(a < b && b < c) {
+		t.Errorf("scores: got chrome=%d, xchat=%d, cache=%d, want increasing", a, b, c)
+	}
+}
+
+func TestWorkspaceNames(t *testing.T) {
+	saved := defaultWorkspaceNames
+	defer func() { defaultWorkspaceNames = saved }()
+	defaultWorkspaceNames = []string{"mail", "build", "web"}
+
+	r := newRoot(0)
+	rect := xp.Rectangle{Width: 1000, Height: 800}
+	var ks []*workspace
+	for i := 0; i < 3; i++ {
+		ks = append(ks, newWorkspace(rect, r.dummyWorkspace.link[prev]))
+	}
+	for i, k := range ks {
+		if want := defaultWorkspaceNames[i]; k.name != want {
+			t.Errorf("workspace #%d: got name %q, want %q", i, k.name, want)
+		}
+	}
+
+	if got := r.unusedDefaultName(); got != "" {
+		t.Errorf("unusedDefaultName: got %q, want \"\"", got)
+	}
+
+	// A renamed workspace's default name can be used again.
+	ks[0].name = "Mailbox"
+	ks[1].name = "Music"
+	if got, want := r.unusedDefaultName(), "mail"; got != want {
+		t.Errorf("unusedDefaultName: got %q, want %q", got, want)
+	}
+
+	testCases := []struct {
+		name string
+		want *workspace
+	}{
+		{"", nil},
+		{"mailbox", ks[0]},
+		{"MUSIC", ks[1]},
+		{"Web", ks[2]},
+		// A prefix matches the first workspace that it is a prefix of.
+		{"m", ks[0]},
+		{"mu", ks[1]},
+		{"mailboxes", nil},
+		{"x", nil},
+	}
+	for _, tc := range testCases {
+		if got := r.findWorkspaceNamed(tc.name); got != tc.want {
+			t.Errorf("findWorkspaceNamed(%q): got %p, want %p", tc.name, got, tc.want)
+		}
+	}
+}
@@ -1,74 +1,403 @@
 package main
 
 import (
+	"log"
 	"time"
 
 	xp "github.com/BurntSushi/xgb/xproto"
 )
 
-func handleButtonPress(e xp.ButtonPressEvent) {
-	s := screenContaining(e.RootX, e.RootY)
-	button := e.Detail
-	if e.State&xp.ModMaskControl != 0 {
-		// Control-click is treated as a Middle Mouse Button.
-		button = 2
-	} else if e.State&xp.ModMask1 != 0 {
-		// Alt-click is treated as a Right Mouse Button.
-		button = 3
-	}
-	if button == 2 {
-		// Middle Mouse Button is treated as Mouse-Wheel Up/Down.
-		if e.State&xp.ModMaskShift != 0 {
-			button = 4
+// textInput is a line of text being typed into a list overlay, such as a
+// workspace's new name. While typing, taowm grabs the keyboard, so that keys
+// don't need to be pressed with the wmKeysym.
+type textInput struct {
+	workspace *workspace
+	prompt    string
+	text      string
+	// hints is whether to label the list items with hintLabels.
+	hints bool
+	// commands are the list items for listCommands, before being filtered
+	// by the text.
+	commands []*command
+	// edit, if non-nil, is called after each change to the text.
+	edit func(k *workspace, text string)
+	// done is called when the Return key is pressed, but not when typing is
+	// cancelled by the Escape key.
+	done func(k *workspace, text string)
+}
+
+var typing *textInput
+
+// startTyping shows the list overlay and a prompt on k's screen, and grabs the
+// keyboard until the Return or Escape key is pressed. It returns nil if the
+// keyboard could not be grabbed.
+func startTyping(k *workspace, l listing, prompt, text string, done func(*workspace, string)) *textInput {
+	if k.screen == nil {
+		return nil
+	}
+	if typing != nil {
+		stopTyping()
+	}
+	if !grabKeyboard(k.root) {
+		return nil
+	}
+	typing = &textInput{
+		workspace: k,
+		prompt:    prompt,
+		text:      text,
+		done:      done,
+	}
+	if k.listing != l {
+		reconcile()
+		k.listing, k.scroll = l, 0
+	}
+	k.makeList()
+	k.focusFrame(k.focusedFrame)
+	return typing
+}
+
+// stopTyping releases the keyboard and hides the list overlay.
+func stopTyping() {
+	t := typing
+	if t == nil {
+		return
+	}
+	typing = nil
+	releaseKeyboard()
+	k := t.workspace
+	if k.listing == listNone || !k.exists() {
+		return
+	}
+	k.listing = listNone
+	if k.screen == nil {
+		k.list, k.index = nil, -1
+		return
+	}
+	k.makeList()
+	k.focusFrame(k.focusedFrame)
+}
+
+// grabKeyboard grabs the keyboard, so that key presses without the wmKeysym
+// still come to taowm.
+func grabKeyboard(r *root) bool {
+	g, err := xp.GrabKeyboard(xConn, false, r.xWin, xp.TimeCurrentTime,
+		xp.GrabModeAsync, xp.GrabModeAsync).Reply()
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	if g.Status != xp.GrabStatusSuccess {
+		log.Printf("could not grab the keyboard: status %d", g.Status)
+		return false
+	}
+	return true
+}
+
+// releaseKeyboard ungrabs the keyboard, unless it is still needed for typing
+// or for a keymap.
+func releaseKeyboard() {
+	if typing == nil && len(keymapStack) == 0 {
+		check(xp.UngrabKeyboardChecked(xConn, xp.TimeCurrentTime))
+	}
+}
+
+// keymap is a set of key bindings, like the actions map, that is active after
+// a prefix key. A sticky keymap, or mode, stays active until the Escape key is
+// pressed. Otherwise, the keymap applies to only the next key press.
+type keymap struct {
+	name    string
+	sticky  bool
+	color   uint32 // The color of the focused frame's border.
+	actions map[int32]action
+}
+
+// keymapStack is the active keymaps. The last one applies to key presses.
+var keymapStack []*keymap
+
+func currentKeymap() *keymap {
+	if n := len(keymapStack); n > 0 {
+		return keymapStack[n-1]
+	}
+	return nil
+}
+
+// doKeymap activates the keymap given by the argument.
+func doKeymap(k *workspace, m1 interface{}) bool {
+	m, ok := m1.(*keymap)
+	if !ok {
+		return false
+	}
+	if (typing == nil && len(keymapStack) == 0) && !grabKeyboard(k.root) {
+		return false
+	}
+	keymapStack = append(keymapStack, m)
+	return true
+}
+
+func popKeymap() {
+	if n := len(keymapStack); n > 0 {
+		keymapStack = keymapStack[:n-1]
+		releaseKeyboard()
+		pulseChan <- time.Now()
+	}
+}
+
+// handleKeymapKeyPress performs the current keymap's action for the key. The
+// keysym is negated, as for the actions map, if the Shift modifier is held.
+func handleKeymapKeyPress(k *workspace, keysym int32) {
+	raw := xp.Keysym(keysym)
+	if keysym < 0 {
+		raw = xp.Keysym(^keysym)
+	}
+	if isModifier(raw) {
+		return
+	}
+	if keysym == xkEscape {
+		popKeymap()
+		return
+	}
+	m := currentKeymap()
+	a, ok := m.actions[keysym]
+	if !ok && m.sticky {
+		// A mode's bare keys can also do what they do with the wmKeysym.
+		a, ok = actions[keysym]
+	}
+	if !m.sticky {
+		popKeymap()
+	}
+	if ok && a.do != nil && a.do(k, a.arg) {
+		pulseChan <- time.Now()
+	}
+}
+
+// isModifier returns whether the keysym is for a key like Shift or Caps Lock,
+// which is pressed along with other keys instead of by itself.
+func isModifier(keysym xp.Keysym) bool {
+	return keysym == wmKeysym || (xkShiftL <= keysym && keysym <= xkHyperR)
+}
+
+func handleTypingKeyPress(keysym xp.Keysym) {
+	t := typing
+	switch {
+	case keysym == xkEscape:
+		stopTyping()
+		return
+	case keysym == xkReturn:
+		// done is called before stopTyping, so that it can see the list.
+		if t.workspace.exists() {
+			t.done(t.workspace, t.text)
+		}
+		if typing == t {
+			stopTyping()
+		}
+		return
+	case keysym == xkUp || keysym == xkDown:
+		k := t.workspace
+		if len(k.list) == 0 {
+			return
+		}
+		i := k.index
+		if keysym == xkUp {
+			i--
 		} else {
-			button = 5
+			i++
+		}
+		if i < 0 {
+			i = 0
+		} else if i >= len(k.list) {
+			i = len(k.list) - 1
+		}
+		k.setIndex(i)
+		if s := k.screen; s != nil {
+			s.repaint()
+		}
+		return
+	case keysym == xkBackspace:
+		if n := len(t.text); n > 0 {
+			t.text = t.text[:n-1]
 		}
+	case 0x20 <= keysym && keysym <= 0x7e:
+		// Printable ASCII keysyms are the same as their characters. The
+		// core X font text requests don't handle UTF-8, so other characters
+		// are ignored.
+		t.text += string(rune(keysym))
+	default:
+		return
 	}
-	k := s.workspace
-	if k.listing != listNone && button > 3 {
+	if t.edit != nil {
+		t.edit(t.workspace, t.text)
+	}
+	if typing != t {
+		return
+	}
+	if k := t.workspace; k.listing == listSearch || k.listing == listCommands {
+		k.makeList()
 		return
 	}
-	if k.listing == listWindows {
-		button = 1
-	} else if k.listing == listWorkspaces {
-		button = 3
+	if s := t.workspace.screen; s != nil {
+		s.repaint()
 	}
+}
+
+// mouseContext is where the mouse pointer is when a mouse button is pressed.
+type mouseContext int
+
+const (
+	// mouseDesktop is an empty frame, not showing a list.
+	mouseDesktop mouseContext = iota
+	// mouseBorder is a frame's border. Unless overridden, mouseDesktop
+	// bindings also apply to mouseBorder.
+	mouseBorder
+	// mouseList is a list overlay, outside of the list's items.
+	mouseList
+)
+
+// mouseModifiers are the modifiers that can be part of a mouse binding.
+const mouseModifiers = xp.ModMaskShift | xp.ModMaskControl | xp.ModMask1 | xp.ModMask4
+
+// dragXxx are pseudo-buttons for when a mouse button is pressed, the mouse
+// moved at least dragDistance pixels and the button released.
+const (
+	dragLeft xp.Button = 0x80 + iota
+	dragRight
+	dragUp
+	dragDown
+)
+
+// anyButton, in a mouseBinding, matches every mouse button and wheel direction
+// that has no binding of its own, but not the dragXxx gestures.
+const anyButton xp.Button = 0
+
+type mouseBinding struct {
+	context mouseContext
+	button  xp.Button
+	state   uint16 // The modifiers, such as xp.ModMaskShift.
+}
+
+// pressed is the mouse button that is pressed, if any, and where and with what
+// modifiers it was pressed.
+var pressed struct {
+	workspace *workspace
+	context   mouseContext
+	button    xp.Button
+	state     uint16
+	x, y      int16
+}
 
-	switch button {
-	case 1:
-		if k.index >= 0 {
-			if iw, ok := k.list[k.index].(*window); ok {
-				k.listing, k.list, k.index = listNone, nil, -1
-				changeWindow(k.focusedFrame, k.focusedFrame.window, iw)
+func (k *workspace) mouseContext(x, y int16) mouseContext {
+	if k.listing != listNone {
+		return mouseList
+	}
+	if !k.fullscreen {
+		if f := k.mainFrame.frameContaining(x, y); f != nil {
+			r := f.rect
+			if x-r.X < 2 || y-r.Y < 2 || r.X+int16(r.Width)-x < 2 || r.Y+int16(r.Height)-y < 2 {
+				return mouseBorder
 			}
-			s.repaint()
-		} else {
-			doList(k, listWindows)
 		}
-	case 3:
-		if k.index >= 0 {
-			if ik, ok := k.list[k.index].(*workspace); ok {
-				k.listing, k.list, k.index = listNone, nil, -1
-				changeWorkspace(s, k, ik)
+	}
+	return mouseDesktop
+}
+
+// doMouseAction performs the mouseActions entry for the button, looking first
+// for an exact match, then for an anyButton match and then ignoring the
+// modifiers.
+func doMouseAction(k *workspace, c mouseContext, button xp.Button, state uint16) {
+	state &= mouseModifiers
+	contexts := []mouseContext{c}
+	if c == mouseBorder {
+		contexts = append(contexts, mouseDesktop)
+	}
+	buttons := []xp.Button{button}
+	if button < dragLeft {
+		buttons = append(buttons, anyButton)
+	}
+	for _, s := range []uint16{state, 0} {
+		for _, c := range contexts {
+			for _, b := range buttons {
+				if a, ok := mouseActions[mouseBinding{c, b, s}]; ok {
+					if a.do(k, a.arg) {
+						pulseChan <- time.Now()
+					}
+					return
+				}
 			}
-			s.repaint()
-		} else {
-			doList(k, listWorkspaces)
 		}
-	case 4:
-		doWindow(k, prev)
-	case 5:
-		doWindow(k, next)
+	}
+}
+
+func handleButtonPress(e xp.ButtonPressEvent) {
+	r := findRoot(func(r *root) bool { return r.xWin == e.Root })
+	if r == nil {
+		return
+	}
+	s := r.screenContaining(e.RootX, e.RootY)
+	k := s.workspace
+	c := k.mouseContext(e.RootX, e.RootY)
+
+	if i := k.indexForPoint(e.RootX, e.RootY); c == mouseList && e.Detail <= 3 && i >= 0 {
+		// Clicking on a list item chooses it.
+		item := k.list[i]
+		stopTyping()
+		k.listing, k.list, k.index = listNone, nil, -1
+		switch item := item.(type) {
+		case *window:
+			showWindow(k, item)
+		case *workspace:
+			changeWorkspace(s, k, item)
+		case *command:
+			item.run(k)
+		}
+		s.repaint()
+	} else if e.Detail > 3 {
+		// Mouse wheels have no drag gestures, so they act immediately.
+		doMouseAction(k, c, e.Detail, e.State)
+		return
+	} else {
+		pressed.workspace, pressed.context = k, c
+		pressed.button, pressed.state = e.Detail, e.State
+		pressed.x, pressed.y = e.RootX, e.RootY
 	}
 
-	if button <= 3 {
-		k = s.workspace
-		w := k.focusedFrame.window
-		if k.listing != listNone {
-			w = nil
+	k = s.workspace
+	w := k.focusedFrame.window
+	if k.listing != listNone {
+		w = nil
+	}
+	focus(r, w)
+}
+
+func handleButtonRelease(e xp.ButtonReleaseEvent) {
+	k := pressed.workspace
+	if k == nil || e.Detail != pressed.button {
+		return
+	}
+	pressed.workspace = nil
+	if !k.exists() || k.screen == nil {
+		return
+	}
+	button := pressed.button
+	dx, dy := int(e.RootX)-int(pressed.x), int(e.RootY)-int(pressed.y)
+	if abs(dx) >= dragDistance || abs(dy) >= dragDistance {
+		switch {
+		case abs(dx) >= abs(dy) && dx < 0:
+			button = dragLeft
+		case abs(dx) >= abs(dy):
+			button = dragRight
+		case dy < 0:
+			button = dragUp
+		default:
+			button = dragDown
 		}
-		focus(w)
 	}
+	doMouseAction(k, pressed.context, button, pressed.state)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
 }
 
 func handleEnterNotify(e xp.EnterNotifyEvent) {
@@ -79,32 +408,41 @@ func handleEnterNotify(e xp.EnterNotifyEvent) {
 	k := w.frame.workspace
 	f0 := k.focusedFrame
 	k.focusFrame(w.frame)
-	if k.listing == listWindows && k.focusedFrame != f0 {
-		k.makeList()
+	if (k.listing == listWindows || k.listing == listSearch) && k.focusedFrame != f0 {
+		k.refreshList()
 	}
 }
 
 func handleKeyPress(e xp.KeyPressEvent) {
-	shift := 0
-	if e.State&xp.ModMaskShift != 0 {
-		shift = 1
+	keysym := int32(lookupKeysym(e.Detail, e.State))
+	if typing != nil {
+		handleTypingKeyPress(xp.Keysym(keysym))
+		return
 	}
-	keysym := int32(keysyms[e.Detail][shift])
-	if shift != 0 {
-		if keysym == 0 {
-			keysym = int32(keysyms[e.Detail][0])
-		}
+	if e.State&xp.ModMaskShift != 0 {
 		keysym = ^keysym
 	}
+	r := findRoot(func(r *root) bool { return r.xWin == e.Root })
+	if r == nil {
+		return
+	}
+	if currentKeymap() != nil {
+		handleKeymapKeyPress(r.screenContaining(e.RootX, e.RootY).workspace, keysym)
+		return
+	}
 	if a := actions[keysym]; a.do != nil {
-		if a.do(screenContaining(e.RootX, e.RootY).workspace, a.arg) {
+		if a.do(r.screenContaining(e.RootX, e.RootY).workspace, a.arg) {
 			pulseChan <- time.Now()
 		}
 	}
 }
 
 func handleMotionNotify(e xp.MotionNotifyEvent) {
-	s := screenContaining(e.RootX, e.RootY)
+	r := findRoot(func(r *root) bool { return r.xWin == e.Root })
+	if r == nil {
+		return
+	}
+	s := r.screenContaining(e.RootX, e.RootY)
 	k := s.workspace
 	f0 := k.focusedFrame
 	if !k.fullscreen && k.listing != listWorkspaces {
@@ -113,10 +451,10 @@ func handleMotionNotify(e xp.MotionNotifyEvent) {
 	if k.listing == listNone {
 		return
 	}
-	i1, i0 := k.indexForPoint(e.RootX, e.RootY), k.index
+	i1, i0 := k.followPointer(e.RootX, e.RootY), k.index
 	k.index = i1
-	if k.listing == listWindows && k.focusedFrame != f0 {
-		k.makeList()
+	if (k.listing == listWindows || k.listing == listSearch) && k.focusedFrame != f0 {
+		k.refreshList()
 		return
 	}
 	if i1 == i0 {
@@ -124,13 +462,13 @@ func handleMotionNotify(e xp.MotionNotifyEvent) {
 	}
 
 	x, y := clip(k)
-	setForeground(colorPulseFocused)
+	r.setForeground(colorPulseFocused)
 	y += int16(fontHeight + fontHeight1)
 	if i0 != -1 {
-		drawText(x+int16(fontWidth), y+int16(i0*fontHeight), " ")
+		r.drawText(x+int16(fontWidth), y+int16((i0-k.scroll)*fontHeight), " ")
 	}
 	if i1 != -1 {
-		drawText(x+int16(fontWidth), y+int16(i1*fontHeight), ">")
+		r.drawText(x+int16(fontWidth), y+int16((i1-k.scroll)*fontHeight), ">")
 	}
-	unclip()
+	r.unclip()
 }
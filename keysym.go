@@ -3,6 +3,8 @@ package main
 // These constants come from /usr/include/X11/keysymdef.h.
 
 import (
+	"fmt"
+
 	xp "github.com/BurntSushi/xgb/xproto"
 )
 
@@ -55,7 +57,48 @@ const (
 )
 
 func keysymString(keysym xp.Keysym) string {
+	if keysym == ' ' {
+		return "Space"
+	}
+	if 0x20 < keysym && keysym <= 0x7e {
+		return string(rune(keysym))
+	}
+	if xkF1 <= keysym && keysym <= xkF12 {
+		return fmt.Sprintf("F%d", keysym-xkF1+1)
+	}
 	switch keysym {
+	case xkISOLeftTab, xkTab:
+		return "Tab"
+	case xkBackspace:
+		return "Backspace"
+	case xkReturn:
+		return "Enter"
+	case xkEscape:
+		return "Escape"
+	case xkHome:
+		return "Home"
+	case xkLeft:
+		return "Left"
+	case xkUp:
+		return "Up"
+	case xkRight:
+		return "Right"
+	case xkDown:
+		return "Down"
+	case xkPageUp:
+		return "PageUp"
+	case xkPageDown:
+		return "PageDown"
+	case xkEnd:
+		return "End"
+	case xkDelete:
+		return "Delete"
+	case xkAudioLowerVolume:
+		return "VolumeDown"
+	case xkAudioMute:
+		return "Mute"
+	case xkAudioRaiseVolume:
+		return "VolumeUp"
 	case xkMenu:
 		return "Menu"
 	case xkShiftL:
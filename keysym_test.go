@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	xp "github.com/BurntSushi/xgb/xproto"
+)
+
+func TestKeysymString(t *testing.T) {
+	testCases := []struct {
+		keysym xp.Keysym
+		want   string
+	}{
+		{' ', "Space"},
+		{'a', "a"},
+		{'T', "T"},
+		{'|', "|"},
+		{'~', "~"},
+		{xkF1, "F1"},
+		{xkF12, "F12"},
+		{xkTab, "Tab"},
+		{xkISOLeftTab, "Tab"},
+		{xkReturn, "Enter"},
+		{xkCapsLock, "CapsLock"},
+		{xkAudioLowerVolume, "VolumeDown"},
+		{0x7f, "UnknownKeysym"},
+		{0x1234, "UnknownKeysym"},
+	}
+	for _, tc := range testCases {
+		if got := keysymString(tc.keysym); got != tc.want {
+			t.Errorf("keysymString(%#x): got %q, want %q", tc.keysym, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// command is a list item that does something when chosen, such as launching
+// a program.
+type command struct {
+	name   string
+	detail string // Extra text to show, such as a key binding, or "".
+	uses   int    // How often the command has been chosen, for sorting.
+	run    func(k *workspace)
+}
+
+// makeCommandList returns the commands whose name or detail fuzzily match
+// the text, best match first. Ties go to the most used command.
+func makeCommandList(commands []*command, text string) (list []interface{}) {
+	type match struct {
+		c     *command
+		score int
+	}
+	var matches []match
+	for _, c := range commands {
+		if score, ok := fuzzyMatch(text, c.name+" "+c.detail); ok {
+			matches = append(matches, match{c, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score < matches[j].score
+		}
+		return matches[i].c.uses > matches[j].c.uses
+	})
+	for _, m := range matches {
+		list = append(list, m.c)
+	}
+	return list
+}
+
+// doLaunch shows a list of programs to launch: the executables in $PATH and
+// the applications described by .desktop files. Typing filters the list, and
+// the Return key launches the program under the cursor or, if nothing
+// matches, runs the typed text as a shell command. Scanning for programs can
+// be slow, so it happens on another goroutine and the list is filled in when
+// the scan finishes.
+func doLaunch(k *workspace, _ interface{}) bool {
+	var history map[string]int
+	t := startTyping(k, listCommands, "Run: ", "", func(k *workspace, text string) {
+		if i := k.index; 0 <= i && i < len(k.list) {
+			if c, ok := k.list[i].(*command); ok {
+				c.run(k)
+				return
+			}
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			return
+		}
+		if history == nil {
+			history = readLaunchHistory()
+		}
+		launch(history, text, []string{"/bin/sh", "-c", text})
+	})
+	if t == nil {
+		return false
+	}
+	go func() {
+		h := readLaunchHistory()
+		commands := launchCommands(h)
+		proactiveChan <- func() {
+			if typing != t {
+				return
+			}
+			history, t.commands = h, commands
+			t.workspace.makeList()
+		}
+	}()
+	return false
+}
+
+// launch runs the program and records that it was run in the history file.
+// The line is how the history file refers to the program.
+func launch(history map[string]int, line string, cmd []string) {
+	history[line]++
+	writeLaunchHistory(history)
+	doExec(nil, cmd)
+}
+
+// launchCommands returns the programs to launch. The history's keys are the
+// command lines of previously launched programs and its values count their
+// launches.
+func launchCommands(history map[string]int) (commands []*command) {
+	seenNames, seenLines := map[string]bool{}, map[string]bool{}
+	add := func(p launchable) {
+		if seenNames[p.name] || seenLines[p.line] {
+			return
+		}
+		seenNames[p.name], seenLines[p.line] = true, true
+		commands = append(commands, &command{
+			name:   p.name,
+			detail: p.detail,
+			uses:   history[p.line],
+			run: func(*workspace) {
+				launch(history, p.line, p.cmd)
+			},
+		})
+	}
+
+	for _, p := range findLaunchables() {
+		add(p)
+	}
+	// Previously typed shell commands, and programs that have since been
+	// uninstalled, are also listed.
+	for line := range history {
+		add(launchable{name: line, line: line, cmd: []string{"/bin/sh", "-c", line}})
+	}
+
+	sort.SliceStable(commands, func(i, j int) bool {
+		if commands[i].uses != commands[j].uses {
+			return commands[i].uses > commands[j].uses
+		}
+		return commands[i].name < commands[j].name
+	})
+	return commands
+}
+
+// launchable is a program to launch. Its line is a shell command line that
+// launches it, and is how the history file refers to it.
+type launchable struct {
+	name   string
+	detail string
+	line   string
+	cmd    []string
+}
+
+// launchCache holds the result of scanning for launchables, as scanning every
+// directory in $PATH is slow. It is valid while the scanned directories'
+// modification times are unchanged. Scans happen off the main goroutine, so
+// the mutex guards the cache.
+var launchCache struct {
+	mu          sync.Mutex
+	mtimes      map[string]time.Time
+	launchables []launchable
+}
+
+// findLaunchables returns the applications described by .desktop files and
+// the executables in $PATH.
+func findLaunchables() []launchable {
+	launchCache.mu.Lock()
+	defer launchCache.mu.Unlock()
+	appDirs := applicationDirs()
+	pathDirs := filepath.SplitList(os.Getenv("PATH"))
+	mtimes := map[string]time.Time{}
+	for _, dir := range append(append([]string(nil), appDirs...), pathDirs...) {
+		if info, err := os.Stat(dir); err == nil {
+			mtimes[dir] = info.ModTime()
+		}
+	}
+	if launchCache.launchables != nil && sameMtimes(mtimes, launchCache.mtimes) {
+		return launchCache.launchables
+	}
+
+	var ls []launchable
+	for _, a := range desktopApplications(appDirs) {
+		ls = append(ls, launchable{a.name, a.exec, a.exec, []string{"/bin/sh", "-c", a.exec}})
+	}
+	for _, dir := range pathDirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			if !info.IsDir() && info.Mode()&0111 != 0 {
+				name := info.Name()
+				ls = append(ls, launchable{name, "", name, []string{filepath.Join(dir, name)}})
+			}
+		}
+	}
+	launchCache.mtimes, launchCache.launchables = mtimes, ls
+	return ls
+}
+
+func sameMtimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for dir, t := range a {
+		if u, ok := b[dir]; !ok || !t.Equal(u) {
+			return false
+		}
+	}
+	return true
+}
+
+type desktopApplication struct {
+	name string
+	exec string
+}
+
+// applicationDirs returns the directories that hold .desktop files, such as
+// /usr/share/applications, most important first.
+func applicationDirs() (dirs []string) {
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range append([]string{xdgDataHome()}, filepath.SplitList(dataDirs)...) {
+		dirs = append(dirs, filepath.Join(dir, "applications"))
+	}
+	return dirs
+}
+
+// desktopApplications returns the applications described by the .desktop
+// files in the directories.
+func desktopApplications(dirs []string) (apps []desktopApplication) {
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.desktop"))
+		for _, m := range matches {
+			// Files in earlier directories take precedence.
+			base := filepath.Base(m)
+			if seen[base] {
+				continue
+			}
+			seen[base] = true
+			if a, ok := readDesktopFile(m); ok {
+				apps = append(apps, a)
+			}
+		}
+	}
+	return apps
+}
+
+// readDesktopFile parses the "[Desktop Entry]" group of a .desktop file. It
+// returns false if the file does not describe an application to show.
+func readDesktopFile(filename string) (a desktopApplication, ok bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return a, false
+	}
+	defer f.Close()
+	inEntry, hidden, typ := false, false, ""
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") {
+			inEntry = line == "[Desktop Entry]"
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if !inEntry || i < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		switch key {
+		case "Name":
+			a.name = value
+		case "Exec":
+			a.exec = stripFieldCodes(value)
+		case "Type":
+			typ = value
+		case "Hidden", "NoDisplay":
+			hidden = hidden || value == "true"
+		}
+	}
+	return a, a.name != "" && a.exec != "" && typ == "Application" && !hidden
+}
+
+// stripFieldCodes removes the %f, %U, etc. field codes from a .desktop file's
+// Exec value, as taowm launches programs without files or URLs to open.
+func stripFieldCodes(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+1 == len(s) {
+			b = append(b, s[i])
+			continue
+		}
+		i++
+		if s[i] == '%' {
+			b = append(b, '%')
+		}
+	}
+	return strings.Join(strings.Fields(string(b)), " ")
+}
+
+// launchHistoryFilename returns the name of the file that records how often
+// each program was launched.
+func launchHistoryFilename() string {
+	return filepath.Join(xdgDataHome(), "taowm", "launch-history")
+}
+
+// xdgDataHome returns the directory for user-specific data files, such as
+// $HOME/.local/share.
+func xdgDataHome() string {
+	if d := os.Getenv("XDG_DATA_HOME"); d != "" {
+		return d
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "share")
+}
+
+// readLaunchHistory reads the history file, whose lines are a count, a tab
+// and a program's command line.
+func readLaunchHistory() map[string]int {
+	history := map[string]int{}
+	b, err := ioutil.ReadFile(launchHistoryFilename())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+		return history
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		i := strings.IndexByte(line, '\t')
+		if i < 0 {
+			continue
+		}
+		if n, err := strconv.Atoi(line[:i]); err == nil && n > 0 {
+			history[line[i+1:]] = n
+		}
+	}
+	return history
+}
+
+func writeLaunchHistory(history map[string]int) {
+	filename := launchHistoryFilename()
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		log.Println(err)
+		return
+	}
+	b := []byte(nil)
+	for name, n := range history {
+		b = append(b, fmt.Sprintf("%d\t%s\n", n, name)...)
+	}
+	// Write to a temporary file and rename it, so that a crash while writing
+	// can't truncate the history.
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestStripFieldCodes(t *testing.T) {
+	testCases := []struct {
+		s, want string
+	}{
+		{"", ""},
+		{"xterm", "xterm"},
+		{"firefox %u", "firefox"},
+		{"gimp-2.10 %U", "gimp-2.10"},
+		{"vlc --started-from-file %F --no-loop", "vlc --started-from-file --no-loop"},
+		{"printf 100%%", "printf 100%"},
+		{"trailing %", "trailing %"},
+		{"  spaced   out  %f ", "spaced out"},
+	}
+	for _, tc := range testCases {
+		if got := stripFieldCodes(tc.s); got != tc.want {
+			t.Errorf("stripFieldCodes(%q): got %q, want %q", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestReadDesktopFile(t *testing.T) {
+	dir := t.TempDir()
+	testCases := []struct {
+		desc     string
+		contents string
+		want     desktopApplication
+		ok       bool
+	}{{
+		desc: "application",
+		contents: "[Desktop Entry]\n" +
+			"Type=Application\n" +
+			"Name=Text Editor\n" +
+			"Exec=gedit %U\n",
+		want: desktopApplication{name: "Text Editor", exec: "gedit"},
+		ok:   true,
+	}, {
+		desc: "other groups are ignored",
+		contents: "# A comment.\n" +
+			"[Desktop Entry]\n" +
+			"Type = Application\n" +
+			"Name = Browser\n" +
+			"Exec = browser %u\n" +
+			"[Desktop Action new-window]\n" +
+			"Name=New Window\n" +
+			"Exec=browser --new-window\n",
+		want: desktopApplication{name: "Browser", exec: "browser"},
+		ok:   true,
+	}, {
+		desc: "no display",
+		contents: "[Desktop Entry]\n" +
+			"Type=Application\n" +
+			"Name=Helper\n" +
+			"Exec=helper\n" +
+			"NoDisplay=true\n",
+		want: desktopApplication{name: "Helper", exec: "helper"},
+	}, {
+		desc: "hidden",
+		contents: "[Desktop Entry]\n" +
+			"Type=Application\n" +
+			"Name=Removed\n" +
+			"Exec=removed\n" +
+			"Hidden=true\n",
+		want: desktopApplication{name: "Removed", exec: "removed"},
+	}, {
+		desc: "link",
+		contents: "[Desktop Entry]\n" +
+			"Type=Link\n" +
+			"Name=Home Page\n" +
+			"URL=http://example.com/\n",
+		want: desktopApplication{name: "Home Page"},
+	}, {
+		desc: "no exec",
+		contents: "[Desktop Entry]\n" +
+			"Type=Application\n" +
+			"Name=Nothing\n",
+		want: desktopApplication{name: "Nothing"},
+	}}
+	for i, tc := range testCases {
+		filename := filepath.Join(dir, tc.desc+".desktop")
+		if err := ioutil.WriteFile(filename, []byte(tc.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, ok := readDesktopFile(filename)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("test case #%d (%s): got %+v, %t, want %+v, %t", i, tc.desc, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	if _, ok := readDesktopFile(filepath.Join(dir, "missing.desktop")); ok {
+		t.Errorf("missing file: got ok, want not ok")
+	}
+}
+
+func TestDesktopApplications(t *testing.T) {
+	dir0, dir1 := t.TempDir(), t.TempDir()
+	files := []struct {
+		dir, base, name string
+	}{
+		{dir0, "editor.desktop", "Local Editor"},
+		{dir1, "editor.desktop", "System Editor"},
+		{dir1, "terminal.desktop", "Terminal"},
+		{dir1, "notes.txt", "Not A Desktop File"},
+	}
+	for _, f := range files {
+		contents := "[Desktop Entry]\nType=Application\nName=" + f.name + "\nExec=x\n"
+		if err := ioutil.WriteFile(filepath.Join(f.dir, f.base), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	apps := desktopApplications([]string{dir0, dir1, filepath.Join(dir0, "missing")})
+	var got []string
+	for _, a := range apps {
+		got = append(got, a.name)
+	}
+	// Files in earlier directories take precedence.
+	want := []string{"Local Editor", "Terminal"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
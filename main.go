@@ -6,13 +6,13 @@ import (
 	"time"
 
 	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
 	"github.com/BurntSushi/xgb/xinerama"
 	xp "github.com/BurntSushi/xgb/xproto"
 )
 
 var (
-	xConn    *xgb.Conn
-	rootXWin xp.Window
+	xConn *xgb.Conn
 
 	eventTime xp.Timestamp
 	keyRootX  int16
@@ -53,34 +53,175 @@ func sendClientMessage(xWin xp.Window, atom xp.Atom) {
 	))
 }
 
+// ping sends a _NET_WM_PING message to the window. If the window does not
+// reply within pingTimeout, it is marked as unresponsive.
+func ping(w *window) {
+	if !w.netWMPing || !w.pingTime.IsZero() {
+		return
+	}
+	xWin, t := w.xWin, time.Now()
+	w.pingTime = t
+	check(xp.SendEventChecked(xConn, false, xWin, xp.EventMaskNoEvent,
+		string(xp.ClientMessageEvent{
+			Format: 32,
+			Window: xWin,
+			Type:   atomWMProtocols,
+			Data: xp.ClientMessageDataUnionData32New([]uint32{
+				uint32(atomNetWMPing),
+				uint32(eventTime),
+				uint32(xWin),
+				0,
+				0,
+			}),
+		}.Bytes()),
+	))
+	time.AfterFunc(pingTimeout, func() {
+		proactiveChan <- func() {
+			// The window may have replied, or been unmanaged, in the meantime.
+			if w.xWin != xWin || w.pingTime != t {
+				return
+			}
+			w.pingTime = time.Time{}
+			w.unresponsive = true
+			makeLists()
+			pulseChan <- time.Now()
+		}
+	})
+}
+
+// handlePong handles a client's reply to a _NET_WM_PING message.
+func handlePong(xWin xp.Window) {
+	w := findWindow(func(w *window) bool { return w.xWin == xWin })
+	if w == nil {
+		return
+	}
+	w.pingTime = time.Time{}
+	if w.unresponsive {
+		w.unresponsive = false
+		makeLists()
+	}
+}
+
 func handleConfigureNotify(e xp.ConfigureNotifyEvent) {
-	if rootXWin != e.Window || (desktopWidth == e.Width && desktopHeight == e.Height) {
+	if d := findDock(e.Window); d != nil {
+		rect := xp.Rectangle{X: e.X, Y: e.Y, Width: e.Width, Height: e.Height}
+		if d.rect != rect {
+			d.rect = rect
+			d.readStruts()
+			d.root.resetScreens()
+		}
+		return
+	}
+	r := findRoot(func(r *root) bool { return r.xWin == e.Window })
+	if r == nil || (r.desktopWidth == e.Width && r.desktopHeight == e.Height) {
 		return
 	}
-	desktopWidth, desktopHeight = e.Width, e.Height
+	r.desktopWidth, r.desktopHeight = e.Width, e.Height
 
 	check(xp.ConfigureWindowChecked(
 		xConn,
-		desktopXWin,
+		r.desktopXWin,
 		xp.ConfigWindowWidth|xp.ConfigWindowHeight,
 		[]uint32{
-			uint32(desktopWidth),
-			uint32(desktopHeight),
+			uint32(r.desktopWidth),
+			uint32(r.desktopHeight),
 		},
 	))
 	check(xp.SetClipRectanglesChecked(
-		xConn, xp.ClipOrderingUnsorted, desktopXGC, 0, 0, []xp.Rectangle{{
-			X: 0, Y: 0, Width: desktopWidth, Height: desktopHeight,
+		xConn, xp.ClipOrderingUnsorted, r.desktopXGC, 0, 0, []xp.Rectangle{{
+			X: 0, Y: 0, Width: r.desktopWidth, Height: r.desktopHeight,
 		}}))
-	check(xp.ClearAreaChecked(xConn, true, desktopXWin, 0, 0, desktopWidth, desktopHeight))
+	for _, d := range r.docks {
+		// Struts are relative to the desktop's edges.
+		d.readStruts()
+	}
+	r.resetScreens()
+}
 
-	initScreens()
-	for k := dummyWorkspace.link[next]; k != &dummyWorkspace; k = k.link[next] {
+// resetScreens re-calculates the root's screens and lays out its workspaces,
+// such as after the root window is resized or a dock window comes or goes.
+func (r *root) resetScreens() {
+	check(xp.ClearAreaChecked(xConn, true, r.desktopXWin, 0, 0, r.desktopWidth, r.desktopHeight))
+	r.initScreens()
+	for k := r.dummyWorkspace.link[next]; k != &r.dummyWorkspace; k = k.link[next] {
 		k.layout()
 	}
 	makeLists()
 }
 
+func handlePropertyNotify(e xp.PropertyNotifyEvent) {
+	if d := findDock(e.Window); d != nil {
+		if e.Atom == atomNetWMStrut || e.Atom == atomNetWMStrutPartial {
+			d.readStruts()
+			d.root.resetScreens()
+		}
+		return
+	}
+	w := findWindow(func(w *window) bool { return w.xWin == e.Window })
+	if w == nil {
+		return
+	}
+	switch e.Atom {
+	case atomNetWMName, atomWMName, atomWMClass:
+		// Some programs set WM_CLASS after mapping their window.
+		if e.Atom == atomWMClass {
+			w.readClass()
+		} else if !w.readName() {
+			return
+		}
+		for _, r := range roots {
+			for _, s := range r.screens {
+				k := s.workspace
+				for _, item := range k.list {
+					if item == w {
+						k.refreshList()
+						break
+					}
+				}
+			}
+		}
+	case atomNetWMState, atomWMHints:
+		w.readUrgency()
+	case atomWMNormalHints:
+		w.readSizeHints()
+		w.configure()
+	}
+}
+
+func handleClientMessage(e xp.ClientMessageEvent) {
+	if e.Type == atomWMProtocols && e.Format == 32 &&
+		xp.Atom(e.Data.Data32[0]) == atomNetWMPing {
+		handlePong(xp.Window(e.Data.Data32[2]))
+		return
+	}
+	if e.Type != atomNetWMState || e.Format != 32 {
+		return
+	}
+	w := findWindow(func(w *window) bool { return w.xWin == e.Window })
+	if w == nil {
+		return
+	}
+	const (
+		netWMStateRemove = 0
+		netWMStateAdd    = 1
+		netWMStateToggle = 2
+	)
+	d := e.Data.Data32
+	for _, a := range d[1:3] {
+		if xp.Atom(a) != atomNetWMStateDemandsAttention {
+			continue
+		}
+		switch d[0] {
+		case netWMStateRemove:
+			w.setUrgent(false)
+		case netWMStateAdd:
+			w.setUrgent(true)
+		case netWMStateToggle:
+			w.setUrgent(!w.urgent)
+		}
+	}
+}
+
 func handleConfigureRequest(e xp.ConfigureRequestEvent) {
 	if w := findWindow(func(w *window) bool { return w.xWin == e.Window }); w != nil {
 		cne := xp.ConfigureNotifyEvent{
@@ -128,17 +269,36 @@ func handleConfigureRequest(e xp.ConfigureRequestEvent) {
 	check(xp.ConfigureWindowChecked(xConn, e.Window, mask, values))
 }
 
-func manage(xWin xp.Window, mapRequest bool) {
+func manage(r *root, xWin xp.Window, mapRequest bool) {
 	callFocus := false
 	w := findWindow(func(w *window) bool { return w.xWin == xWin })
 	if w == nil {
-		wmDeleteWindow, wmTakeFocus := false, false
+		wType := windowType(xWin)
+		switch wType {
+		case atomNetWMWindowTypeDock:
+			manageDock(r, xWin, mapRequest)
+			return
+		case atomNetWMWindowTypeNotification, atomNetWMWindowTypeSplash,
+			atomNetWMWindowTypeTooltip:
+			// Such windows are short-lived and shown where they ask to be,
+			// above other windows. They are not framed or listed.
+			if mapRequest {
+				check(xp.ConfigureWindowChecked(xConn, xWin, xp.ConfigWindowStackMode,
+					[]uint32{xp.StackModeAbove}))
+				check(xp.MapWindowChecked(xConn, xWin))
+			}
+			return
+		}
+
+		netWMPing, wmDeleteWindow, wmTakeFocus := false, false, false
 		if prop, err := xp.GetProperty(xConn, false, xWin, atomWMProtocols,
 			xp.GetPropertyTypeAny, 0, 64).Reply(); err != nil {
 			log.Println(err)
 		} else if prop != nil {
 			for v := prop.Value; len(v) >= 4; v = v[4:] {
 				switch xp.Atom(u32(v)) {
+				case atomNetWMPing:
+					netWMPing = true
 				case atomWMDeleteWindow:
 					wmDeleteWindow = true
 				case atomWMTakeFocus:
@@ -160,11 +320,25 @@ func manage(xWin xp.Window, mapRequest bool) {
 			}
 		}
 
-		k := screens[0].workspace
-		if p, err := xp.QueryPointer(xConn, rootXWin).Reply(); err != nil {
+		k := r.screens[0].workspace
+		if p, err := xp.QueryPointer(xConn, r.xWin).Reply(); err != nil {
 			log.Println(err)
 		} else if p != nil {
-			k = screenContaining(p.RootX, p.RootY).workspace
+			k = r.screenContaining(p.RootX, p.RootY).workspace
+		}
+		remembered := placement{}
+		if m, ok := withdrawn[xWin]; ok {
+			// The window was withdrawn and is now being re-mapped. Put it
+			// back where it was, if that workspace still exists.
+			delete(withdrawn, xWin)
+			if m.workspace.exists() {
+				k, remembered = m.workspace, m
+			}
+		}
+		if transientFor == nil && wType == atomNetWMWindowTypeDialog {
+			// A dialog without a WM_TRANSIENT_FOR is treated as transient for
+			// the window that presumably opened it.
+			transientFor = k.focusedFrame.window
 		}
 		w = &window{
 			transientFor: transientFor,
@@ -175,13 +349,21 @@ func manage(xWin xp.Window, mapRequest bool) {
 				Width:  1,
 				Height: 1,
 			},
+			netWMPing:      netWMPing,
 			wmDeleteWindow: wmDeleteWindow,
 			wmTakeFocus:    wmTakeFocus,
 		}
+		w.readName()
+		w.readClass()
+		w.readSizeHints()
+		w.readUrgency()
 		f := k.focusedFrame
 		previous := k.dummyWindow.link[prev]
 		if transientFor != nil {
 			previous = transientFor
+		} else if p := remembered.previous; p != nil &&
+			(p == &k.dummyWindow || p.workspace() == k) {
+			previous = p
 		} else if f.window != nil {
 			previous = f.window
 		}
@@ -193,18 +375,22 @@ func manage(xWin xp.Window, mapRequest bool) {
 		if transientFor != nil && transientFor.frame != nil {
 			f = transientFor.frame
 			f.window, transientFor.frame = nil, nil
-		} else if f.window != nil {
+		} else if r := remembered.frame; r != nil && r.window == nil &&
+			r.firstChild == nil && k.mainFrame.hasDescendent(r) {
+			f = r
+		} else if remembered.frame != nil || f.window != nil {
 			f = k.mainFrame.firstEmptyFrame()
 		}
 		if f != nil {
 			f.window, w.frame = w, f
-			callFocus = f == k.focusedFrame
+			callFocus = f == k.focusedFrame && k.screen != nil
 		} else {
 			pulseChan <- time.Now()
 		}
 
 		check(xp.ChangeWindowAttributesChecked(xConn, xWin, xp.CwEventMask,
-			[]uint32{xp.EventMaskEnterWindow | xp.EventMaskStructureNotify},
+			[]uint32{xp.EventMaskEnterWindow | xp.EventMaskPropertyChange |
+				xp.EventMaskStructureNotify},
 		))
 		w.configure()
 		if transientFor != nil {
@@ -216,13 +402,111 @@ func manage(xWin xp.Window, mapRequest bool) {
 		check(xp.MapWindowChecked(xConn, xWin))
 	}
 	if callFocus {
-		focus(w)
+		focus(r, w)
 	}
 	makeLists()
 	pulseChan <- time.Now()
 }
 
-func unmanage(xWin xp.Window) {
+// windowType returns the first atom in xWin's _NET_WM_WINDOW_TYPE property
+// that taowm has a policy for, or zero if there is no such atom.
+func windowType(xWin xp.Window) xp.Atom {
+	prop, err := xp.GetProperty(xConn, false, xWin, atomNetWMWindowType,
+		xp.AtomAtom, 0, 64).Reply()
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+	if prop == nil {
+		return 0
+	}
+	for v := prop.Value; len(v) >= 4; v = v[4:] {
+		switch a := xp.Atom(u32(v)); a {
+		case atomNetWMWindowTypeDialog, atomNetWMWindowTypeDock,
+			atomNetWMWindowTypeNormal, atomNetWMWindowTypeNotification,
+			atomNetWMWindowTypeSplash, atomNetWMWindowTypeTooltip:
+			return a
+		}
+	}
+	return 0
+}
+
+func manageDock(r *root, xWin xp.Window, mapRequest bool) {
+	if findDock(xWin) == nil {
+		d := &dock{root: r, xWin: xWin}
+		if g, err := xp.GetGeometry(xConn, xp.Drawable(xWin)).Reply(); err != nil {
+			log.Println(err)
+		} else if g != nil {
+			d.rect = xp.Rectangle{X: g.X, Y: g.Y, Width: g.Width, Height: g.Height}
+		}
+		d.readStruts()
+		r.docks = append(r.docks, d)
+		check(xp.ChangeWindowAttributesChecked(xConn, xWin, xp.CwEventMask,
+			[]uint32{xp.EventMaskPropertyChange | xp.EventMaskStructureNotify},
+		))
+		r.resetScreens()
+	}
+	if mapRequest {
+		check(xp.MapWindowChecked(xConn, xWin))
+	}
+}
+
+func unmanageDock(xWin xp.Window) bool {
+	for _, r := range roots {
+		for i, d := range r.docks {
+			if d.xWin == xWin {
+				r.docks = append(r.docks[:i], r.docks[i+1:]...)
+				r.resetScreens()
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withdrawn remembers where withdrawn windows were, so that re-mapping such a
+// window puts it back in the same place. Its entries are removed when the X
+// window is destroyed.
+var withdrawn = map[xp.Window]placement{}
+
+type placement struct {
+	workspace *workspace
+	frame     *frame
+	// previous is the window before it in the workspace's list of windows.
+	previous *window
+}
+
+func handleUnmapNotify(e xp.UnmapNotifyEvent) {
+	// Taowm selects SubstructureRedirect but not SubstructureNotify on the
+	// root window, so an UnmapNotify on the root window was sent by a client
+	// to withdraw its window, as per ICCCM section 4.1.4. All other unmaps are
+	// reported on the window itself.
+	synthetic := findRoot(func(r *root) bool { return r.xWin == e.Event }) != nil
+	w := findWindow(func(w *window) bool { return w.xWin == e.Window })
+	if w == nil {
+		unmanage(e.Window, false)
+		return
+	}
+	if !synthetic && w.expectedUnmaps > 0 {
+		// Taowm unmapped the window, so it is not being withdrawn.
+		w.expectedUnmaps--
+		return
+	}
+	withdrawn[w.xWin] = placement{w.workspace(), w.frame, w.link[prev]}
+	unmanage(e.Window, false)
+}
+
+func handleDestroyNotify(e xp.DestroyNotifyEvent) {
+	delete(withdrawn, e.Window)
+	unmanage(e.Window, true)
+}
+
+// unmanage stops managing the X window. If destroyed, the X window no longer
+// exists, so its properties aren't updated.
+func unmanage(xWin xp.Window, destroyed bool) {
+	if unmanageDock(xWin) {
+		return
+	}
 	w := findWindow(func(w *window) bool { return w.xWin == xWin })
 	if w == nil {
 		return
@@ -266,10 +550,10 @@ func unmanage(xWin xp.Window) {
 			}
 			f.window, replacement.frame = replacement, f
 			replacement.configure()
-			if p, err := xp.QueryPointer(xConn, rootXWin).Reply(); err != nil {
+			if p, err := xp.QueryPointer(xConn, k.root.xWin).Reply(); err != nil {
 				log.Println(err)
 			} else if p != nil && contains(f.rect, p.RootX, p.RootY) {
-				focus(replacement)
+				focus(k.root, replacement)
 			}
 		} else {
 			f.window = nil
@@ -278,6 +562,9 @@ func unmanage(xWin xp.Window) {
 			}
 		}
 	}
+	if !destroyed {
+		w.setWMState(wmStateWithdrawn)
+	}
 	w.link[next].link[prev] = w.link[prev]
 	w.link[prev].link[next] = w.link[next]
 	*w = window{}
@@ -285,6 +572,40 @@ func unmanage(xWin xp.Window) {
 	pulseChan <- time.Now()
 }
 
+// reconcile unmanages those windows whose X windows no longer exist, such as
+// when a program crashes while taowm is managing its window, and the
+// UnmapNotify or DestroyNotify event was missed.
+func reconcile() {
+	type query struct {
+		xWin   xp.Window
+		cookie xp.GetWindowAttributesCookie
+	}
+	var queries []query
+	for _, r := range roots {
+		for k := r.dummyWorkspace.link[next]; k != &r.dummyWorkspace; k = k.link[next] {
+			for w := k.dummyWindow.link[next]; w != &k.dummyWindow; w = w.link[next] {
+				queries = append(queries, query{w.xWin, xp.GetWindowAttributes(xConn, w.xWin)})
+			}
+		}
+		for _, d := range r.docks {
+			queries = append(queries, query{d.xWin, xp.GetWindowAttributes(xConn, d.xWin)})
+		}
+	}
+	for xWin := range withdrawn {
+		queries = append(queries, query{xWin, xp.GetWindowAttributes(xConn, xWin)})
+	}
+	for _, q := range queries {
+		if _, err := q.cookie.Reply(); err != nil {
+			if _, ok := err.(xp.WindowError); ok {
+				delete(withdrawn, q.xWin)
+				unmanage(q.xWin, true)
+			} else {
+				log.Println(err)
+			}
+		}
+	}
+}
+
 type xEventOrError struct {
 	event xgb.Event
 	error xgb.Error
@@ -292,31 +613,53 @@ type xEventOrError struct {
 
 func main() {
 	var err error
+	registerXkbEvents()
 	xConn, err = xgb.NewConn()
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err = xinerama.Init(xConn); err != nil {
+	useRandR = initRandR()
+	if err = xinerama.Init(xConn); err == nil {
+		useXinerama = true
+	} else if !useRandR {
 		log.Fatal(err)
 	}
+	if xkb = initXkb(); xkb == nil {
+		log.Println("XKB is unavailable; using the core keyboard mapping")
+	}
 	xSetup := xp.Setup(xConn)
-	if len(xSetup.Roots) != 1 {
-		log.Fatalf("X setup has unsupported number of roots: %d", len(xSetup.Roots))
+	if len(xSetup.Roots) == 0 {
+		log.Fatal("X setup has no roots")
+	}
+	for _, xScreen := range xSetup.Roots {
+		roots = append(roots, newRoot(xScreen.Root))
 	}
-	rootXWin = xSetup.Roots[0].Root
 
-	becomeTheWM()
+	for _, r := range roots {
+		r.becomeTheWM()
+	}
 	initAtoms()
-	initDesktop(&xSetup.Roots[0])
+	for i, r := range roots {
+		r.initNetSupported()
+		r.initDesktop(&xSetup.Roots[i], i)
+	}
 	initKeyboardMapping()
-	initScreens()
+	for _, r := range roots {
+		r.selectRandRInput()
+		r.initScreens()
+	}
 
 	// Manage any existing windows.
-	if tree, err := xp.QueryTree(xConn, rootXWin).Reply(); err != nil {
-		log.Fatal(err)
-	} else if tree != nil {
+	for _, r := range roots {
+		tree, err := xp.QueryTree(xConn, r.xWin).Reply()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if tree == nil {
+			continue
+		}
 		for _, c := range tree.Children {
-			if c == desktopXWin {
+			if c == r.desktopXWin {
 				continue
 			}
 			attrs, err := xp.GetWindowAttributes(xConn, c).Reply()
@@ -326,7 +669,7 @@ func main() {
 			if attrs.OverrideRedirect || attrs.MapState == xp.MapStateUnmapped {
 				continue
 			}
-			manage(c, false)
+			manage(r, c, false)
 		}
 	}
 
@@ -334,10 +677,16 @@ func main() {
 	// there's typically only one screen. The last frame because, for
 	// left-to-right languages, the last frame's text is typically closer to
 	// the screen center than the first frame's text.
-	if len(screens) > 0 {
-		warpPointerTo(screens[0].workspace.mainFrame.lastDescendent())
+	if s := roots[0].screens; len(s) > 0 {
+		warpPointerTo(s[0].workspace.mainFrame.lastDescendent())
 	}
 
+	go func() {
+		for range time.Tick(reconcileDuration) {
+			proactiveChan <- reconcile
+		}
+	}()
+
 	// Process X events.
 	eeChan := make(chan xEventOrError)
 	go func() {
@@ -364,19 +713,34 @@ func main() {
 				continue
 			}
 			switch e := ee.event.(type) {
+			case randr.NotifyEvent:
+				if e.SubCode == randr.NotifyOutputChange {
+					if r := findRoot(func(r *root) bool { return r.xWin == e.U.Oc.Window }); r != nil {
+						r.resetScreens()
+					}
+				}
+			case xkbEvent:
+				if xkb != nil {
+					xkb.handleEvent(e)
+				}
+			case randr.ScreenChangeNotifyEvent:
+				if r := findRoot(func(r *root) bool { return r.xWin == e.Root }); r != nil {
+					r.resetScreens()
+				}
 			case xp.ButtonPressEvent:
 				eventTime = e.Time
 				handleButtonPress(e)
 			case xp.ButtonReleaseEvent:
 				eventTime = e.Time
+				handleButtonRelease(e)
 			case xp.ClientMessageEvent:
-				// No-op.
+				handleClientMessage(e)
 			case xp.ConfigureNotifyEvent:
 				handleConfigureNotify(e)
 			case xp.ConfigureRequestEvent:
 				handleConfigureRequest(e)
 			case xp.DestroyNotifyEvent:
-				// No-op.
+				handleDestroyNotify(e)
 			case xp.EnterNotifyEvent:
 				eventTime = e.Time
 				handleEnterNotify(e)
@@ -390,14 +754,19 @@ func main() {
 			case xp.MapNotifyEvent:
 				// No-op.
 			case xp.MappingNotifyEvent:
-				// No-op.
+				handleMappingNotify(e)
 			case xp.MapRequestEvent:
-				manage(e.Window, true)
+				if r := findRoot(func(r *root) bool { return r.xWin == e.Parent }); r != nil {
+					manage(r, e.Window, true)
+				}
 			case xp.MotionNotifyEvent:
 				eventTime = e.Time
 				handleMotionNotify(e)
+			case xp.PropertyNotifyEvent:
+				eventTime = e.Time
+				handlePropertyNotify(e)
 			case xp.UnmapNotifyEvent:
-				unmanage(e.Window)
+				handleUnmapNotify(e)
 			default:
 				log.Printf("unhandled event: %v", ee.event)
 			}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	xp "github.com/BurntSushi/xgb/xproto"
+)
+
+// paletteActions is the actions map. It is set by init, as doPalette referring
+// to the actions map directly would be an initialization cycle: the actions
+// map refers to doPalette.
+var paletteActions map[int32]action
+
+func init() {
+	paletteActions = actions
+}
+
+// doPalette shows a list of every key binding and what it does. Typing
+// filters the list, and the Return key performs the action under the cursor.
+func doPalette(k *workspace, _ interface{}) bool {
+	var commands []*command
+	add := func(name string, a action) {
+		commands = append(commands, &command{
+			name:   name,
+			detail: describeAction(a),
+			run: func(k *workspace) {
+				if a.do(k, a.arg) {
+					pulseChan <- time.Now()
+				}
+			},
+		})
+	}
+	for key, a := range paletteActions {
+		add(chordString(key), a)
+		// A keymap's keys are listed after the chord that starts it.
+		if m, ok := a.arg.(*keymap); ok {
+			for mKey, mAction := range m.actions {
+				add(chordString(key)+" "+keyString(mKey), mAction)
+			}
+		}
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		if commands[i].detail != commands[j].detail {
+			return commands[i].detail < commands[j].detail
+		}
+		return commands[i].name < commands[j].name
+	})
+	t := startTyping(k, listCommands, "Action: ", "", func(k *workspace, _ string) {
+		if i := k.index; 0 <= i && i < len(k.list) {
+			if c, ok := k.list[i].(*command); ok {
+				// Hide the palette first, as the action may show a list.
+				stopTyping()
+				c.run(k)
+			}
+		}
+	})
+	if t != nil {
+		t.commands = commands
+		k.makeList()
+	}
+	return false
+}
+
+// chordString returns how to type a key of the actions map, such as
+// "Caps+Shift+T".
+func chordString(key int32) string {
+	s := keysymString(wmKeysym)
+	if s == "CapsLock" {
+		s = "Caps"
+	}
+	return s + "+" + keyString(key)
+}
+
+// keyString returns how to type a key of an actions map without the wmKeysym,
+// such as "Shift+T".
+func keyString(key int32) string {
+	if key < 0 {
+		return "Shift+" + keysymString(xp.Keysym(^key))
+	}
+	return keysymString(xp.Keysym(key))
+}
+
+// describeAction returns the action's description, with any "%s" replaced by
+// a description of its argument.
+func describeAction(a action) string {
+	if strings.Contains(a.desc, "%s") {
+		return fmt.Sprintf(a.desc, describeArg(a.arg))
+	}
+	return a.desc
+}
+
+func describeArg(arg interface{}) string {
+	switch arg := arg.(type) {
+	case nil:
+		return ""
+	case int:
+		// Action arguments are 0-based but the descriptions are 1-based.
+		return fmt.Sprint(arg + 1)
+	case traversal:
+		if arg == next {
+			return "next"
+		}
+		return "previous"
+	case orientation:
+		if arg == horizontal {
+			return "horizontally"
+		}
+		return "vertically"
+	case listing:
+		switch arg {
+		case listWindows:
+			return "windows"
+		case listWorkspaces:
+			return "workspaces"
+		case listSearch:
+			return "search results"
+		case listCommands:
+			return "commands"
+		}
+	case []string:
+		return strings.Join(arg, " ")
+	case xp.Button:
+		switch arg {
+		case 4:
+			return "mouse wheel up"
+		case 5:
+			return "mouse wheel down"
+		}
+		return fmt.Sprintf("mouse button %d", arg)
+	case xp.Keysym:
+		return keysymString(arg)
+	case programAction:
+		if int(arg) < len(programActionNames) {
+			return programActionNames[arg]
+		}
+	case string:
+		return arg
+	case *keymap:
+		return arg.name
+	}
+	return fmt.Sprint(arg)
+}
+
+var programActionNames = [nProgramActions]string{
+	paTabNew:       "new tab",
+	paTabClose:     "close tab",
+	paTabPrev:      "previous tab",
+	paTabNext:      "next tab",
+	paTabNudgePrev: "move tab left",
+	paTabNudgeNext: "move tab right",
+	paSearch:       "search",
+	paCut:          "cut",
+	paCopy:         "copy",
+	paPaste:        "paste",
+	paPasteSpecial: "paste special",
+	paZoomIn:       "zoom in",
+	paZoomOut:      "zoom out",
+	paZoomReset:    "reset zoom",
+	paThemePrev:    "previous theme",
+	paThemeNext:    "next theme",
+}
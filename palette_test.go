@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyString(t *testing.T) {
+	testCases := []struct {
+		key  int32
+		want string
+	}{
+		{+'t', "t"},
+		{^'T', "Shift+T"},
+		{+xkReturn, "Enter"},
+		{^xkReturn, "Shift+Enter"},
+		{+xkF2, "F2"},
+		{^xkF2, "Shift+F2"},
+	}
+	for _, tc := range testCases {
+		if got := keyString(tc.key); got != tc.want {
+			t.Errorf("keyString(%d): got %q, want %q", tc.key, got, tc.want)
+		}
+		// chordString prefixes the wmKeysym, whatever it is configured to be.
+		if got := chordString(tc.key); !strings.HasSuffix(got, "+"+tc.want) {
+			t.Errorf("chordString(%d): got %q, want suffix %q", tc.key, got, "+"+tc.want)
+		}
+	}
+}
+
+func TestDescribeAction(t *testing.T) {
+	testCases := []struct {
+		a    action
+		want string
+	}{
+		{action{doSplit, horizontal, "split the focused frame %s"}, "split the focused frame horizontally"},
+		{action{doScreenMigrate, 2, "move the focused window to screen %s"}, "move the focused window to screen 3"},
+		{action{doScreenMigrate, next, "move the focused window to the %s screen"}, "move the focused window to the next screen"},
+		{action{doList, listCommands, "list %s"}, "list commands"},
+		{action{doList, listSearch, "list %s"}, "list search results"},
+		{action{doProgramAction, paZoomIn, "program: %s"}, "program: zoom in"},
+		{action{doExec, []string{"xterm", "-e", "top"}, "run %s"}, "run xterm -e top"},
+		{action{doPalette, nil, "list every action"}, "list every action"},
+	}
+	for _, tc := range testCases {
+		if got := describeAction(tc.a); got != tc.want {
+			t.Errorf("describeAction(%q, %v): got %q, want %q", tc.a.desc, tc.a.arg, got, tc.want)
+		}
+	}
+}
@@ -2,33 +2,58 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"log"
-	"os/exec"
 
+	"github.com/BurntSushi/xgb/randr"
 	"github.com/BurntSushi/xgb/xinerama"
 	xp "github.com/BurntSushi/xgb/xproto"
 )
 
 var (
-	atomNetActiveWindow xp.Atom
-	atomNetWMName       xp.Atom
-	atomWindow          xp.Atom
-	atomWMClass         xp.Atom
-	atomWMDeleteWindow  xp.Atom
-	atomWMProtocols     xp.Atom
-	atomWMTakeFocus     xp.Atom
-	atomWMTransientFor  xp.Atom
-
-	desktopXWin   xp.Window
-	desktopXGC    xp.Gcontext
-	desktopWidth  uint16
-	desktopHeight uint16
+	atomCompoundText                xp.Atom
+	atomEDID                        xp.Atom
+	atomNetActiveWindow             xp.Atom
+	atomNetSupported                xp.Atom
+	atomNetSupportingWMCheck        xp.Atom
+	atomNetWMName                   xp.Atom
+	atomNetWMPID                    xp.Atom
+	atomNetWMPing                   xp.Atom
+	atomNetWMState                  xp.Atom
+	atomNetWMStateDemandsAttention  xp.Atom
+	atomNetWMStrut                  xp.Atom
+	atomNetWMStrutPartial           xp.Atom
+	atomNetWMWindowType             xp.Atom
+	atomNetWMWindowTypeDialog       xp.Atom
+	atomNetWMWindowTypeDock         xp.Atom
+	atomNetWMWindowTypeNormal       xp.Atom
+	atomNetWMWindowTypeNotification xp.Atom
+	atomNetWMWindowTypeSplash       xp.Atom
+	atomNetWMWindowTypeTooltip      xp.Atom
+	atomNetWorkArea                 xp.Atom
+	atomUTF8String                  xp.Atom
+	atomWindow                      xp.Atom
+	atomWMClass                     xp.Atom
+	atomWMClientMachine             xp.Atom
+	atomWMDeleteWindow              xp.Atom
+	atomWMHints                     xp.Atom
+	atomWMName                      xp.Atom
+	atomWMNormalHints               xp.Atom
+	atomWMProtocols                 xp.Atom
+	atomWMState                     xp.Atom
+	atomWMTakeFocus                 xp.Atom
+	atomWMTransientFor              xp.Atom
 
 	keysyms [256][2]xp.Keysym
+
+	// useRandR and useXinerama are whether the X server supports those
+	// extensions, for finding the physical monitors. RandR is preferred.
+	useRandR    bool
+	useXinerama bool
 )
 
-func becomeTheWM() {
-	if err := xp.ChangeWindowAttributesChecked(xConn, rootXWin, xp.CwEventMask, []uint32{
+func (r *root) becomeTheWM() {
+	if err := xp.ChangeWindowAttributesChecked(xConn, r.xWin, xp.CwEventMask, []uint32{
 		xp.EventMaskButtonPress |
 			xp.EventMaskButtonRelease |
 			xp.EventMaskPointerMotion |
@@ -43,16 +68,108 @@ func becomeTheWM() {
 }
 
 func initAtoms() {
+	atomCompoundText = internAtom("COMPOUND_TEXT")
+	atomEDID = internAtom("EDID")
 	atomNetActiveWindow = internAtom("_NET_ACTIVE_WINDOW")
+	atomNetSupported = internAtom("_NET_SUPPORTED")
+	atomNetSupportingWMCheck = internAtom("_NET_SUPPORTING_WM_CHECK")
 	atomNetWMName = internAtom("_NET_WM_NAME")
+	atomNetWMPID = internAtom("_NET_WM_PID")
+	atomNetWMPing = internAtom("_NET_WM_PING")
+	atomNetWMState = internAtom("_NET_WM_STATE")
+	atomNetWMStateDemandsAttention = internAtom("_NET_WM_STATE_DEMANDS_ATTENTION")
+	atomNetWMStrut = internAtom("_NET_WM_STRUT")
+	atomNetWMStrutPartial = internAtom("_NET_WM_STRUT_PARTIAL")
+	atomNetWMWindowType = internAtom("_NET_WM_WINDOW_TYPE")
+	atomNetWMWindowTypeDialog = internAtom("_NET_WM_WINDOW_TYPE_DIALOG")
+	atomNetWMWindowTypeDock = internAtom("_NET_WM_WINDOW_TYPE_DOCK")
+	atomNetWMWindowTypeNormal = internAtom("_NET_WM_WINDOW_TYPE_NORMAL")
+	atomNetWMWindowTypeNotification = internAtom("_NET_WM_WINDOW_TYPE_NOTIFICATION")
+	atomNetWMWindowTypeSplash = internAtom("_NET_WM_WINDOW_TYPE_SPLASH")
+	atomNetWMWindowTypeTooltip = internAtom("_NET_WM_WINDOW_TYPE_TOOLTIP")
+	atomNetWorkArea = internAtom("_NET_WORKAREA")
+	atomUTF8String = internAtom("UTF8_STRING")
 	atomWindow = internAtom("WINDOW")
 	atomWMClass = internAtom("WM_CLASS")
+	atomWMClientMachine = internAtom("WM_CLIENT_MACHINE")
 	atomWMDeleteWindow = internAtom("WM_DELETE_WINDOW")
+	atomWMHints = internAtom("WM_HINTS")
+	atomWMName = internAtom("WM_NAME")
+	atomWMNormalHints = internAtom("WM_NORMAL_HINTS")
 	atomWMProtocols = internAtom("WM_PROTOCOLS")
+	atomWMState = internAtom("WM_STATE")
 	atomWMTakeFocus = internAtom("WM_TAKE_FOCUS")
 	atomWMTransientFor = internAtom("WM_TRANSIENT_FOR")
 }
 
+// initNetSupported announces which EWMH hints taowm supports.
+func (r *root) initNetSupported() {
+	r.initNetSupportingWMCheck()
+	supported := []xp.Atom{
+		atomNetActiveWindow,
+		atomNetSupportingWMCheck,
+		atomNetWMName,
+		atomNetWMPing,
+		atomNetWMState,
+		atomNetWMStateDemandsAttention,
+		atomNetWMStrut,
+		atomNetWMStrutPartial,
+		atomNetWMWindowType,
+		atomNetWMWindowTypeDialog,
+		atomNetWMWindowTypeDock,
+		atomNetWMWindowTypeNormal,
+		atomNetWMWindowTypeNotification,
+		atomNetWMWindowTypeSplash,
+		atomNetWMWindowTypeTooltip,
+		atomNetWorkArea,
+	}
+	b := make([]byte, 0, 4*len(supported))
+	for _, a := range supported {
+		b = append(b, byte(a>>0), byte(a>>8), byte(a>>16), byte(a>>24))
+	}
+	if err := xp.ChangePropertyChecked(xConn, xp.PropModeReplace, r.xWin,
+		atomNetSupported, xp.AtomAtom, 32, uint32(len(supported)), b).Check(); err != nil {
+		log.Printf("could not set _NET_SUPPORTED: %v", err)
+	}
+}
+
+// initNetSupportingWMCheck creates the small, unmapped window that EWMH
+// clients look for to tell that a compliant window manager is running. Both
+// it and the root point to it with _NET_SUPPORTING_WM_CHECK, and both are
+// named with _NET_WM_NAME.
+func (r *root) initNetSupportingWMCheck() {
+	xWin, err := xp.NewWindowId(xConn)
+	if err != nil {
+		log.Printf("could not create the _NET_SUPPORTING_WM_CHECK window: %v", err)
+		return
+	}
+	if err := xp.CreateWindowChecked(
+		xConn, 0, xWin, r.xWin,
+		-1, -1, 1, 1, 0,
+		xp.WindowClassInputOnly,
+		0,
+		xp.CwOverrideRedirect,
+		[]uint32{
+			1,
+		},
+	).Check(); err != nil {
+		log.Printf("could not create the _NET_SUPPORTING_WM_CHECK window: %v", err)
+		return
+	}
+	b := []byte{byte(xWin >> 0), byte(xWin >> 8), byte(xWin >> 16), byte(xWin >> 24)}
+	const name = "taowm"
+	for _, w := range [2]xp.Window{xWin, r.xWin} {
+		if err := xp.ChangePropertyChecked(xConn, xp.PropModeReplace, w,
+			atomNetSupportingWMCheck, atomWindow, 32, 1, b).Check(); err != nil {
+			log.Printf("could not set _NET_SUPPORTING_WM_CHECK: %v", err)
+		}
+		if err := xp.ChangePropertyChecked(xConn, xp.PropModeReplace, w,
+			atomNetWMName, atomUTF8String, 8, uint32(len(name)), []byte(name)).Check(); err != nil {
+			log.Printf("could not set _NET_WM_NAME: %v", err)
+		}
+	}
+}
+
 func internAtom(name string) xp.Atom {
 	r, err := xp.InternAtom(xConn, false, uint16(len(name)), name).Reply()
 	if err != nil {
@@ -64,7 +181,9 @@ func internAtom(name string) xp.Atom {
 	return r.Atom
 }
 
-func initDesktop(xScreen *xp.ScreenInfo) {
+// initDesktop creates the root's desktop window. screenNum is the root's index
+// in the X server's list of roots.
+func (r *root) initDesktop(xScreen *xp.ScreenInfo, screenNum int) {
 	xCursorFont, err := xp.NewFontId(xConn)
 	if err != nil {
 		log.Fatal(err)
@@ -99,20 +218,20 @@ func initDesktop(xScreen *xp.ScreenInfo) {
 	}
 	defer xp.CloseFont(xConn, xTextFont)
 
-	desktopXWin, err = xp.NewWindowId(xConn)
+	r.desktopXWin, err = xp.NewWindowId(xConn)
 	if err != nil {
 		log.Fatal(err)
 	}
-	desktopXGC, err = xp.NewGcontextId(xConn)
+	r.desktopXGC, err = xp.NewGcontextId(xConn)
 	if err != nil {
 		log.Fatal(err)
 	}
-	desktopWidth = xScreen.WidthInPixels
-	desktopHeight = xScreen.HeightInPixels
+	r.desktopWidth = xScreen.WidthInPixels
+	r.desktopHeight = xScreen.HeightInPixels
 
 	if err := xp.CreateWindowChecked(
-		xConn, xScreen.RootDepth, desktopXWin, xScreen.Root,
-		0, 0, desktopWidth, desktopHeight, 0,
+		xConn, xScreen.RootDepth, r.desktopXWin, xScreen.Root,
+		0, 0, r.desktopWidth, r.desktopHeight, 0,
 		xp.WindowClassInputOutput,
 		xScreen.RootVisual,
 		xp.CwOverrideRedirect|xp.CwEventMask,
@@ -125,12 +244,12 @@ func initDesktop(xScreen *xp.ScreenInfo) {
 	}
 
 	if len(xSettings) != 0 {
-		initXSettings()
+		r.initXSettings(screenNum)
 	}
 
 	if err := xp.ConfigureWindowChecked(
 		xConn,
-		desktopXWin,
+		r.desktopXWin,
 		xp.ConfigWindowStackMode,
 		[]uint32{
 			xp.StackModeBelow,
@@ -141,7 +260,7 @@ func initDesktop(xScreen *xp.ScreenInfo) {
 
 	if err := xp.ChangeWindowAttributesChecked(
 		xConn,
-		desktopXWin,
+		r.desktopXWin,
 		xp.CwBackPixel|xp.CwCursor,
 		[]uint32{
 			xScreen.BlackPixel,
@@ -153,7 +272,7 @@ func initDesktop(xScreen *xp.ScreenInfo) {
 
 	if err := xp.CreateGCChecked(
 		xConn,
-		desktopXGC,
+		r.desktopXGC,
 		xp.Drawable(xScreen.Root),
 		xp.GcFont,
 		[]uint32{
@@ -163,31 +282,73 @@ func initDesktop(xScreen *xp.ScreenInfo) {
 		log.Fatal(err)
 	}
 
-	if err := xp.MapWindowChecked(xConn, desktopXWin).Check(); err != nil {
+	if err := xp.MapWindowChecked(xConn, r.desktopXWin).Check(); err != nil {
 		log.Fatal(err)
 	}
 }
 
+var (
+	// grabbedKeycodes are the keys grabbed on every root, to be ungrabbed
+	// when the keyboard mapping changes.
+	grabbedKeycodes []xp.Keycode
+	// wmKeycode is the keycode of the wmKeysym. It is remembered in case a
+	// new mapping no longer has the wmKeysym.
+	wmKeycode xp.Keycode
+)
+
 func initKeyboardMapping() {
+	if err := updateKeyboardMapping(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// handleMappingNotify re-reads the keyboard mapping after it changes, such as
+// when a keyboard is plugged in or the layout is switched.
+func handleMappingNotify(e xp.MappingNotifyEvent) {
+	if e.Request != xp.MappingKeyboard && e.Request != xp.MappingModifier {
+		return
+	}
+	if err := updateKeyboardMapping(); err != nil {
+		log.Println(err)
+	}
+}
+
+// updateKeyboardMapping reads the keysyms, including the XKB groups and levels
+// if XKB is available, grabs the window manager and media keys on every root
+// and, if the wmKeysym is Caps Lock, disables Caps Lock.
+func updateKeyboardMapping() error {
 	const (
 		keyLo = 8
 		keyHi = 255
 	)
 	km, err := xp.GetKeyboardMapping(xConn, keyLo, keyHi-keyLo+1).Reply()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	if km == nil {
-		log.Fatal("couldn't get keyboard mapping")
+		return fmt.Errorf("couldn't get keyboard mapping")
 	}
 	n := int(km.KeysymsPerKeycode)
 	if n < 2 {
-		log.Fatalf("too few keysyms per keycode: %d", n)
+		return fmt.Errorf("too few keysyms per keycode: %d", n)
 	}
 	for i := keyLo; i <= keyHi; i++ {
 		keysyms[i][0] = km.Keysyms[(i-keyLo)*n+0]
 		keysyms[i][1] = km.Keysyms[(i-keyLo)*n+1]
 	}
+	if xkb != nil {
+		if err := xkb.readMap(); err != nil {
+			// The core keysyms are used instead.
+			log.Println(err)
+		}
+	}
+
+	for _, keycode := range grabbedKeycodes {
+		for _, r := range roots {
+			check(xp.UngrabKeyChecked(xConn, keycode, r.xWin, xp.ModMaskAny))
+		}
+	}
+	grabbedKeycodes = nil
 
 	toGrabs := []xp.Keysym{wmKeysym}
 	if doAudioActions {
@@ -201,105 +362,389 @@ func initKeyboardMapping() {
 				break
 			}
 		}
-		if keycode == 0 {
-			if toGrab != wmKeysym {
-				continue
+		if toGrab == wmKeysym {
+			if keycode == 0 {
+				keycode = wmKeycode
+			}
+			if keycode == 0 {
+				return fmt.Errorf("could not find the window manager key %s", keysymString(toGrab))
 			}
-			log.Fatalf("could not find the window manager key %s", keysymString(toGrab))
+			wmKeycode = keycode
+		} else if keycode == 0 {
+			continue
 		}
-		if err := xp.GrabKeyChecked(xConn, false, rootXWin, xp.ModMaskAny, keycode,
-			xp.GrabModeAsync, xp.GrabModeAsync).Check(); err != nil {
-			log.Fatal(err)
+		for _, r := range roots {
+			if err := xp.GrabKeyChecked(xConn, false, r.xWin, xp.ModMaskAny, keycode,
+				xp.GrabModeAsync, xp.GrabModeAsync).Check(); err != nil {
+				return err
+			}
 		}
+		grabbedKeycodes = append(grabbedKeycodes, keycode)
 	}
 
-	// Disable Caps Lock if it is the wmKeysym.
 	if wmKeysym == xkCapsLock {
-		// On Ubuntu 12.04, disabling Caps Lock involved the equivalent of
-		// `xmodmap -e "clear lock"`. On Ubuntu 14.04, XKB has replaced xmodmap,
-		// possibly because this facilitates per-window keyboard layouts, so the
-		// equivalent of `xmodmap -e "clear lock"` doesn't work. As of October
-		// 2014, github.com/BurntSushi/xgb doesn't support XKB, so we exec the
-		// setxkbmap program instead of speaking the X11 protocol directly to
-		// disable Caps Lock.
-		if err := exec.Command("setxkbmap", "-option", "caps:none").Run(); err != nil {
-			log.Fatalf("setxkbmap failed: %v", err)
+		return disableCapsLock()
+	}
+	return nil
+}
+
+// disableCapsLock disables Caps Lock, as it is the wmKeysym. With XKB, the
+// Caps Lock key still locks the Lock modifier, but xkb.handleEvent unlocks it
+// straight away. Without XKB, the Caps Lock key is removed from the Lock
+// modifier, the equivalent of `xmodmap -e "clear lock"`.
+func disableCapsLock() error {
+	if xkb != nil {
+		if xkb.capsLockLocked() {
+			xkb.unlockCapsLock()
+		}
+		return nil
+	}
+	// Changing the modifier mapping causes another MappingNotify, which
+	// finds that there is nothing left to do.
+	if !capsLockEnabled() {
+		return nil
+	}
+	mm, err := xp.GetModifierMapping(xConn).Reply()
+	if err != nil {
+		return err
+	}
+	n := int(mm.KeycodesPerModifier)
+	for i, keycode := range mm.Keycodes[n : 2*n] {
+		if keycode == wmKeycode {
+			mm.Keycodes[n+i] = 0
 		}
 	}
+	sm, err := xp.SetModifierMapping(xConn, mm.KeycodesPerModifier, mm.Keycodes).Reply()
+	if err != nil {
+		return err
+	}
+	if sm.Status != xp.MappingStatusSuccess {
+		return fmt.Errorf("couldn't disable Caps Lock: mapping status %d", sm.Status)
+	}
+	return nil
+}
+
+// capsLockEnabled returns whether the wmKeycode sets the Lock modifier.
+func capsLockEnabled() bool {
+	mm, err := xp.GetModifierMapping(xConn).Reply()
+	if err != nil || mm == nil {
+		return false
+	}
+	// The Lock modifier is the second of the eight modifiers.
+	n := int(mm.KeycodesPerModifier)
+	for _, keycode := range mm.Keycodes[n : 2*n] {
+		if keycode != 0 && keycode == wmKeycode {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupKeysym returns the keysym of the key for the modifiers and group in a
+// core event's state. Key bindings are Latin keysyms, so on a non-Latin layout
+// such as Russian, letters are looked up in the first group instead, which is
+// usually Latin.
+func lookupKeysym(keycode xp.Keycode, state uint16) xp.Keysym {
+	if xkb == nil || !xkb.haveMap {
+		shift := 0
+		if state&xp.ModMaskShift != 0 {
+			shift = 1
+		}
+		if keysym := keysyms[keycode][shift]; keysym != 0 {
+			return keysym
+		}
+		return keysyms[keycode][0]
+	}
+	keysym := xkb.lookup(keycode, state)
+	if keysym > 0xff && state>>xkbGroupShift&0x03 != 0 {
+		if k := xkb.lookup(keycode, state&^(0x03<<xkbGroupShift)); 0 < k && k <= 0xff {
+			return k
+		}
+	}
+	return keysym
 }
 
-func findKeycode(keysym xp.Keysym) (keycode xp.Keycode, shift bool) {
+// findKeycode returns a keycode and core event state that type the keysym.
+func findKeycode(keysym xp.Keysym) (keycode xp.Keycode, state uint16) {
+	if xkb != nil && xkb.haveMap {
+		if keycode, state := xkb.find(keysym); keycode != 0 {
+			return keycode, state
+		}
+	}
 	for i, k := range keysyms {
 		if k[0] == keysym {
-			return xp.Keycode(i), false
+			return xp.Keycode(i), 0
 		}
 		if k[1] == keysym {
-			return xp.Keycode(i), true
+			return xp.Keycode(i), xp.KeyButMaskShift
 		}
 	}
-	return 0, false
+	return 0, 0
 }
 
-func initScreens() {
-	oldScreens := screens
+func (r *root) initScreens() {
+	oldScreens := r.screens
 
-	xine, err := xinerama.QueryScreens(xConn).Reply()
-	if err != nil {
-		log.Fatal(err)
-	}
-	if len(xine.ScreenInfo) > 0 {
-		screens = make([]*screen, len(xine.ScreenInfo))
-		for i, si := range xine.ScreenInfo {
-			screens[i] = &screen{
-				rect: xp.Rectangle{
+	screens := r.randrScreens()
+	// Xinerama spans a single root over multiple monitors, and is not
+	// active when there are multiple roots.
+	if len(screens) == 0 && useXinerama && len(roots) == 1 {
+		xine, err := xinerama.QueryScreens(xConn).Reply()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, si := range xine.ScreenInfo {
+			screens = append(screens, &screen{
+				root: r,
+				bounds: xp.Rectangle{
 					X:      si.XOrg,
 					Y:      si.YOrg,
 					Width:  si.Width - 1,
 					Height: si.Height - 1,
 				},
-			}
+			})
 		}
-	} else {
-		screens = make([]*screen, 1)
-		screens[0] = &screen{
-			rect: xp.Rectangle{
+	}
+	if len(screens) == 0 {
+		screens = append(screens, &screen{
+			root: r,
+			bounds: xp.Rectangle{
 				X:      0,
 				Y:      0,
-				Width:  desktopWidth - 1,
-				Height: desktopHeight - 1,
+				Width:  r.desktopWidth - 1,
+				Height: r.desktopHeight - 1,
 			},
+		})
+	}
+	screens = splitScreens(screens)
+	r.screens = screens
+
+	workArea := xp.Rectangle{Width: r.desktopWidth - 1, Height: r.desktopHeight - 1}
+	for _, d := range r.docks {
+		for e, strut := range d.struts {
+			workArea = reserve(workArea, edge(e), strut)
+		}
+	}
+	for _, s := range screens {
+		s.rect = s.bounds
+		for _, d := range r.docks {
+			for e, strut := range d.struts {
+				s.rect = reserve(s.rect, edge(e), strut)
+			}
+		}
+	}
+	r.setWorkArea(workArea)
+
+	for _, s := range oldScreens {
+		if s.monitor != "" && s.workspace != nil {
+			r.monitorWorkspaces[s.monitor] = s.workspace
 		}
 	}
 
+	// A monitor gets back the workspace it last showed, if it still exists.
+	// Other screens keep the workspace at the same index, or get a new one.
+	taken := map[*workspace]bool{}
+	for _, s := range screens {
+		if s.monitor == "" {
+			continue
+		}
+		if k := r.monitorWorkspaces[s.monitor]; k != nil && !taken[k] && k.exists() {
+			s.workspace, taken[k] = k, true
+		}
+	}
 	for i, s := range screens {
-		k := (*workspace)(nil)
-		if i < len(oldScreens) {
-			k = oldScreens[i].workspace
-			oldScreens[i].workspace = nil
+		if s.workspace != nil {
+			continue
+		}
+		if i < len(oldScreens) && !taken[oldScreens[i].workspace] {
+			s.workspace = oldScreens[i].workspace
 		} else {
-			k = newWorkspace(s.rect, dummyWorkspace.link[prev])
+			s.workspace = newWorkspace(s.rect, r.dummyWorkspace.link[prev])
 		}
-		s.workspace, k.screen = k, s
+		taken[s.workspace] = true
+	}
+
+	for _, s := range oldScreens {
+		s.workspace.screen = nil
+		s.workspace = nil
 	}
+	for _, s := range screens {
+		s.workspace.screen = s
+	}
+}
 
-	if len(oldScreens) > len(screens) {
-		for _, s := range oldScreens[len(screens):] {
-			s.workspace.screen = nil
-			s.workspace = nil
+// splitScreens replaces each screen that is listed in virtualScreens with
+// several screens, one per configured rectangle.
+func splitScreens(screens []*screen) (ret []*screen) {
+	for _, s := range screens {
+		n := len(ret)
+		for i, rect := range virtualScreens[s.name] {
+			// Clip the rectangle to the monitor. Bounds are inclusive.
+			x0, y0 := int(s.bounds.X)+int(rect.X), int(s.bounds.Y)+int(rect.Y)
+			x1, y1 := x0+int(rect.Width)-1, y0+int(rect.Height)-1
+			if x0 < int(s.bounds.X) {
+				x0 = int(s.bounds.X)
+			}
+			if y0 < int(s.bounds.Y) {
+				y0 = int(s.bounds.Y)
+			}
+			if max := int(s.bounds.X) + int(s.bounds.Width); x1 > max {
+				x1 = max
+			}
+			if max := int(s.bounds.Y) + int(s.bounds.Height); y1 > max {
+				y1 = max
+			}
+			if x1 <= x0 || y1 <= y0 {
+				log.Printf("virtual screen %q #%d is outside its monitor", s.name, i)
+				continue
+			}
+			v := &screen{
+				root: s.root,
+				name: s.name,
+				bounds: xp.Rectangle{
+					X:      int16(x0),
+					Y:      int16(y0),
+					Width:  uint16(x1 - x0),
+					Height: uint16(y1 - y0),
+				},
+			}
+			if s.monitor != "" {
+				v.monitor = fmt.Sprintf("%s#%d", s.monitor, i)
+			}
+			ret = append(ret, v)
+		}
+		if len(ret) == n {
+			ret = append(ret, s)
 		}
 	}
+	return ret
 }
 
-func initXSettings() {
-	a0 := internAtom("_XSETTINGS_S0")
-	if err := xp.SetSelectionOwnerChecked(xConn, desktopXWin, a0,
+// initRandR returns whether the X server supports RandR 1.2 or later, which
+// can list monitors by name and report when they are plugged or unplugged.
+func initRandR() bool {
+	if err := randr.Init(xConn); err != nil {
+		return false
+	}
+	v, err := randr.QueryVersion(xConn, 1, 2).Reply()
+	if err != nil || v == nil {
+		return false
+	}
+	return v.MajorVersion > 1 || (v.MajorVersion == 1 && v.MinorVersion >= 2)
+}
+
+// randrScreens returns one screen per active RandR output, with the primary
+// output first, or nil if RandR is unavailable. An output that mirrors another
+// output does not get its own screen.
+func (r *root) randrScreens() (screens []*screen) {
+	if !useRandR {
+		return nil
+	}
+	res, err := randr.GetScreenResourcesCurrent(xConn, r.xWin).Reply()
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	primary := randr.Output(0)
+	if p, err := randr.GetOutputPrimary(xConn, r.xWin).Reply(); err != nil {
+		log.Println(err)
+	} else if p != nil {
+		primary = p.Output
+	}
+outputs:
+	for _, o := range res.Outputs {
+		oi, err := randr.GetOutputInfo(xConn, o, res.ConfigTimestamp).Reply()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if oi.Connection != randr.ConnectionConnected || oi.Crtc == 0 {
+			continue
+		}
+		ci, err := randr.GetCrtcInfo(xConn, oi.Crtc, res.ConfigTimestamp).Reply()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if ci.Width == 0 || ci.Height == 0 {
+			continue
+		}
+		s := &screen{
+			root:    r,
+			name:    string(oi.Name),
+			monitor: string(oi.Name) + monitorID(o),
+			bounds: xp.Rectangle{
+				X:      ci.X,
+				Y:      ci.Y,
+				Width:  ci.Width - 1,
+				Height: ci.Height - 1,
+			},
+		}
+		for _, s1 := range screens {
+			if s1.bounds == s.bounds {
+				continue outputs
+			}
+		}
+		if o == primary {
+			screens = append([]*screen{s}, screens...)
+		} else {
+			screens = append(screens, s)
+		}
+	}
+	return screens
+}
+
+// monitorID returns a suffix that identifies the physical monitor connected to
+// an output, from the manufacturer, product and serial number in its EDID, or
+// "" if the EDID is unavailable.
+func monitorID(o randr.Output) string {
+	p, err := randr.GetOutputProperty(xConn, o, atomEDID, xp.AtomAny, 0, 32, false, false).Reply()
+	if err != nil || p == nil || p.Format != 8 || len(p.Data) < 18 {
+		return ""
+	}
+	return fmt.Sprintf("/%x", p.Data[8:18])
+}
+
+// selectRandRInput asks for RandR events, so that taowm can react to monitors
+// being plugged in, unplugged or re-arranged.
+func (r *root) selectRandRInput() {
+	if !useRandR {
+		return
+	}
+	check(randr.SelectInputChecked(xConn, r.xWin,
+		randr.NotifyMaskScreenChange|randr.NotifyMaskOutputChange))
+}
+
+// setWorkArea publishes the _NET_WORKAREA property: the part of the desktop
+// not reserved by docks. Taowm does not have EWMH desktops, so there is only
+// one rectangle, spanning all of the root's screens. With several monitors,
+// a dock along one monitor's edge shrinks that rectangle as if it were along
+// every monitor's edge. The per-screen work areas, each screen's rect, are
+// not published.
+func (r *root) setWorkArea(rect xp.Rectangle) {
+	b := make([]byte, 0, 16)
+	for _, u := range [4]uint32{
+		uint32(uint16(rect.X)),
+		uint32(uint16(rect.Y)),
+		uint32(rect.Width) + 1,
+		uint32(rect.Height) + 1,
+	} {
+		b = append(b, byte(u>>0), byte(u>>8), byte(u>>16), byte(u>>24))
+	}
+	check(xp.ChangePropertyChecked(xConn, xp.PropModeReplace, r.xWin,
+		atomNetWorkArea, xp.AtomCardinal, 32, 4, b))
+}
+
+func (r *root) initXSettings(screenNum int) {
+	a0 := internAtom(fmt.Sprintf("_XSETTINGS_S%d", screenNum))
+	if err := xp.SetSelectionOwnerChecked(xConn, r.desktopXWin, a0,
 		xp.TimeCurrentTime).Check(); err != nil {
 		log.Printf("could not set xsettings: %v", err)
 		return
 	}
 	a1 := internAtom("_XSETTINGS_SETTINGS")
 	encoded := makeEncodedXSettings()
-	if err := xp.ChangePropertyChecked(xConn, xp.PropModeReplace, desktopXWin, a1, a1,
+	if err := xp.ChangePropertyChecked(xConn, xp.PropModeReplace, r.desktopXWin, a1, a1,
 		8, uint32(len(encoded)), encoded).Check(); err != nil {
 		log.Printf("could not set xsettings: %v", err)
 		return
@@ -356,6 +801,23 @@ func writeUint32(b *bytes.Buffer, u uint32) {
 	b.WriteByte(byte(u >> 24))
 }
 
+// cardinals returns xWin's 32-bit property a, such as _NET_WM_STRUT, or nil if
+// there is no such property.
+func cardinals(xWin xp.Window, a xp.Atom) []uint32 {
+	p, err := xp.GetProperty(xConn, false, xWin, a, xp.GetPropertyTypeAny, 0, 64).Reply()
+	if err != nil {
+		log.Println(err)
+	}
+	if p == nil || p.Format != 32 {
+		return nil
+	}
+	v := make([]uint32, 0, len(p.Value)/4)
+	for b := p.Value; len(b) >= 4; b = b[4:] {
+		v = append(v, u32(b))
+	}
+	return v
+}
+
 func u32(b []byte) uint32 {
 	return uint32(b[0])<<0 | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	xp "github.com/BurntSushi/xgb/xproto"
+)
+
+func TestSplitScreens(t *testing.T) {
+	saved := virtualScreens
+	defer func() { virtualScreens = saved }()
+	virtualScreens = map[string][]xp.Rectangle{
+		"DP-1": {
+			{X: 0, Y: 0, Width: 1280, Height: 1440},
+			{X: 1280, Y: 0, Width: 2560, Height: 1440},
+			{X: 3840, Y: 0, Width: 1280, Height: 1440},
+		},
+		"DP-2": {
+			// This rectangle extends past the monitor's right edge.
+			{X: 960, Y: 0, Width: 5000, Height: 1080},
+			// This rectangle is entirely outside the monitor.
+			{X: 3000, Y: 0, Width: 100, Height: 100},
+		},
+		"DP-3": {
+			{X: 5000, Y: 0, Width: 100, Height: 100},
+		},
+	}
+
+	screens := splitScreens([]*screen{
+		{name: "DP-1", monitor: "m1", bounds: xp.Rectangle{X: 0, Y: 0, Width: 5119, Height: 1439}},
+		{name: "DP-2", monitor: "m2", bounds: xp.Rectangle{X: 5120, Y: 0, Width: 1919, Height: 1079}},
+		{name: "DP-3", monitor: "m3", bounds: xp.Rectangle{X: 7040, Y: 0, Width: 1023, Height: 767}},
+		{name: "HDMI-1", bounds: xp.Rectangle{X: 8064, Y: 0, Width: 1023, Height: 767}},
+	})
+	testCases := []struct {
+		name, monitor string
+		bounds        xp.Rectangle
+	}{
+		{"DP-1", "m1#0", xp.Rectangle{X: 0, Y: 0, Width: 1279, Height: 1439}},
+		{"DP-1", "m1#1", xp.Rectangle{X: 1280, Y: 0, Width: 2559, Height: 1439}},
+		{"DP-1", "m1#2", xp.Rectangle{X: 3840, Y: 0, Width: 1279, Height: 1439}},
+		{"DP-2", "m2#0", xp.Rectangle{X: 6080, Y: 0, Width: 959, Height: 1079}},
+		// A monitor with no usable virtual screens is left whole.
+		{"DP-3", "m3", xp.Rectangle{X: 7040, Y: 0, Width: 1023, Height: 767}},
+		{"HDMI-1", "", xp.Rectangle{X: 8064, Y: 0, Width: 1023, Height: 767}},
+	}
+	if len(screens) != len(testCases) {
+		t.Fatalf("got %d screens, want %d", len(screens), len(testCases))
+	}
+	for i, tc := range testCases {
+		s := screens[i]
+		if s.name != tc.name || s.monitor != tc.monitor || s.bounds != tc.bounds {
+			t.Errorf("screen #%d: got %q %q %v, want %q %q %v",
+				i, s.name, s.monitor, s.bounds, tc.name, tc.monitor, tc.bounds)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/BurntSushi/xgb"
+	xp "github.com/BurntSushi/xgb/xproto"
+)
+
+// As of this writing, github.com/BurntSushi/xgb doesn't have an XKB package,
+// so the few XKB requests that taowm needs are written out by hand. The
+// request and reply layouts are from the X Keyboard Extension Protocol
+// Specification.
+
+const (
+	xkbUseExtension   = 0
+	xkbSelectEvents   = 1
+	xkbGetState       = 4
+	xkbLatchLockState = 5
+	xkbGetMap         = 8
+
+	xkbUseCoreKbd = 0x0100
+
+	xkbNewKeyboardNotify = 0
+	xkbMapNotify         = 1
+	xkbStateNotify       = 2
+
+	xkbModifierLockMask = 1 << 3
+	xkbGroupStateMask   = 1 << 4
+
+	xkbKeyTypesMask = 1 << 0
+	xkbKeySymsMask  = 1 << 1
+
+	xkbClampIntoRange    = 0x40
+	xkbRedirectIntoRange = 0x80
+
+	// xkbGroupShift is where the group is in a core event's state.
+	xkbGroupShift = 13
+)
+
+// xkb is the keyboard as described by the XKB extension, or nil if the X
+// server doesn't support XKB, in which case the core keysyms are used.
+var xkb *xkbKeyboard
+
+type xkbKeyboard struct {
+	opcode byte
+	// haveMap is whether the key types and keys were read. If not, the core
+	// keysyms are used.
+	haveMap bool
+	// group is the keyboard's effective group, such as 1 when a second
+	// keyboard layout is active.
+	group int
+	types []xkbKeyType
+	keys  [256]xkbKey
+}
+
+// xkbKeyType maps the modifiers held to a shift level.
+type xkbKeyType struct {
+	modsMask byte
+	entries  []xkbKeyTypeEntry
+}
+
+type xkbKeyTypeEntry struct {
+	mods  byte
+	level int
+}
+
+// xkbKey is a key's keysyms: width levels for each of its groups.
+type xkbKey struct {
+	types     [4]byte
+	groupInfo byte
+	width     int
+	syms      []xp.Keysym
+}
+
+// xkbEvent is an XKB event. All XKB events share one event code, and the
+// second byte says which event it is.
+type xkbEvent []byte
+
+func (e xkbEvent) Bytes() []byte  { return e }
+func (e xkbEvent) String() string { return fmt.Sprintf("XKB event %d", e[1]) }
+
+// xkbFirstEvent is the event code of XKB events, or 0 if XKB is unavailable.
+var xkbFirstEvent byte
+
+// registerXkbEvents tells xgb how to read XKB events. It must be called before
+// xConn connects, as xgb's goroutine that reads events reads xgb.NewEventFuncs
+// without locking. Extension event codes are the same for every connection to
+// an X server, so a short-lived connection finds XKB's.
+func registerXkbEvents() {
+	c, err := xgb.NewConn()
+	if err != nil {
+		// Connecting xConn will report the error.
+		return
+	}
+	q, err := xp.QueryExtension(c, uint16(len("XKEYBOARD")), "XKEYBOARD").Reply()
+	c.Close()
+	if err != nil || q == nil || !q.Present {
+		return
+	}
+	xkbFirstEvent = q.FirstEvent
+	xgb.NewEventFuncs[int(xkbFirstEvent)] = func(buf []byte) xgb.Event {
+		return xkbEvent(append([]byte(nil), buf...))
+	}
+}
+
+// initXkb returns the XKB keyboard, or nil if XKB is unavailable.
+func initXkb() *xkbKeyboard {
+	q, err := xp.QueryExtension(xConn, uint16(len("XKEYBOARD")), "XKEYBOARD").Reply()
+	if err != nil || q == nil || !q.Present || q.FirstEvent != xkbFirstEvent {
+		return nil
+	}
+	x := &xkbKeyboard{opcode: q.MajorOpcode}
+
+	// Version 1.0 is the only version of XKB.
+	body := make([]byte, 4)
+	xgb.Put16(body[0:], 1)
+	xgb.Put16(body[2:], 0)
+	if b, err := x.request(xkbUseExtension, body, true).Reply(); err != nil || b == nil || b[1] == 0 {
+		return nil
+	}
+
+	// Once taowm uses XKB, the X server no longer sends it MappingNotify
+	// events for changes to the key types and keysyms, only XKB MapNotify
+	// events. A StateNotify is only needed when the group changes or Caps
+	// Lock locks, not for every modifier key press.
+	const (
+		affectWhich = 1<<xkbNewKeyboardNotify | 1<<xkbMapNotify | 1<<xkbStateNotify
+		selectAll   = 1 << xkbNewKeyboardNotify
+		mapParts    = xkbKeyTypesMask | xkbKeySymsMask
+		stateParts  = xkbModifierLockMask | xkbGroupStateMask
+	)
+	body = make([]byte, 16)
+	xgb.Put16(body[0:], xkbUseCoreKbd)
+	xgb.Put16(body[2:], affectWhich)
+	xgb.Put16(body[4:], 0) // clear.
+	xgb.Put16(body[6:], selectAll)
+	xgb.Put16(body[8:], mapParts)  // affectMap.
+	xgb.Put16(body[10:], mapParts) // map.
+	// The details for the events neither cleared nor selected in full,
+	// other than MapNotify: only StateNotify.
+	xgb.Put16(body[12:], stateParts) // affectState.
+	xgb.Put16(body[14:], stateParts) // stateDetails.
+	if err := x.request(xkbSelectEvents, body, false).Check(); err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	body = make([]byte, 4)
+	xgb.Put16(body[0:], xkbUseCoreKbd)
+	b, err := x.request(xkbGetState, body, true).Reply()
+	if err != nil || b == nil {
+		log.Println(err)
+		return nil
+	}
+	x.group = int(b[12])
+	return x
+}
+
+// request sends an XKB request with the given minor opcode and body, whose
+// length must be a multiple of 4.
+func (x *xkbKeyboard) request(opcode byte, body []byte, reply bool) *xgb.Cookie {
+	buf := make([]byte, 4+len(body))
+	buf[0] = x.opcode
+	buf[1] = opcode
+	xgb.Put16(buf[2:], uint16(len(buf)/4))
+	copy(buf[4:], body)
+	cookie := xConn.NewCookie(true, reply)
+	xConn.NewRequest(buf, cookie)
+	return cookie
+}
+
+// readMap reads the key types and every key's keysyms.
+func (x *xkbKeyboard) readMap() error {
+	x.haveMap = false
+	body := make([]byte, 24)
+	xgb.Put16(body[0:], xkbUseCoreKbd)
+	xgb.Put16(body[2:], xkbKeyTypesMask|xkbKeySymsMask) // full.
+	b, err := x.request(xkbGetMap, body, true).Reply()
+	if err != nil {
+		return err
+	}
+	types, keys, err := parseMap(b)
+	if err != nil {
+		return err
+	}
+	x.types, x.keys, x.haveMap = types, keys, true
+	return nil
+}
+
+// parseMap parses the key types and keysyms of a GetMap reply.
+func parseMap(b []byte) (types []xkbKeyType, keys [256]xkbKey, err error) {
+	errMap := fmt.Errorf("couldn't get XKB keyboard map")
+	if len(b) < 40 {
+		return nil, keys, errMap
+	}
+	nTypes := int(b[15])
+	firstKeySym, nKeySyms := int(b[17]), int(b[20])
+
+	i := 40
+	types = make([]xkbKeyType, nTypes)
+	for t := range types {
+		if i+8 > len(b) {
+			return nil, keys, errMap
+		}
+		types[t].modsMask = b[i]
+		nEntries, hasPreserve := int(b[i+5]), b[i+6] != 0
+		i += 8
+		if i+8*nEntries > len(b) {
+			return nil, keys, errMap
+		}
+		for e := 0; e < nEntries; e++ {
+			if b[i] != 0 {
+				types[t].entries = append(types[t].entries, xkbKeyTypeEntry{
+					mods:  b[i+1],
+					level: int(b[i+2]),
+				})
+			}
+			i += 8
+		}
+		if hasPreserve {
+			i += 4 * nEntries
+		}
+	}
+
+	for k := firstKeySym; k < firstKeySym+nKeySyms && k < len(keys); k++ {
+		if i+8 > len(b) {
+			return nil, keys, errMap
+		}
+		key := &keys[k]
+		copy(key.types[:], b[i:i+4])
+		key.groupInfo = b[i+4]
+		key.width = int(b[i+5])
+		nSyms := int(xgb.Get16(b[i+6:]))
+		i += 8
+		// lookup and find index syms by group and level, so a key must
+		// have a keysym for every level of every group.
+		if i+4*nSyms > len(b) || nSyms < int(key.groupInfo&0x0f)*key.width {
+			return nil, keys, errMap
+		}
+		key.syms = make([]xp.Keysym, nSyms)
+		for s := range key.syms {
+			key.syms[s] = xp.Keysym(xgb.Get32(b[i:]))
+			i += 4
+		}
+	}
+	return types, keys, nil
+}
+
+// handleEvent re-reads the keyboard mapping when it changes, tracks the group
+// and, if the wmKeysym is Caps Lock, unlocks the Lock modifier whenever the
+// Caps Lock key locks it.
+func (x *xkbKeyboard) handleEvent(e xkbEvent) {
+	switch e[1] {
+	case xkbNewKeyboardNotify, xkbMapNotify:
+		if err := updateKeyboardMapping(); err != nil {
+			log.Println(err)
+		}
+	case xkbStateNotify:
+		x.group = int(e[13])
+		if e[12]&xp.ModMaskLock != 0 && wmKeysym == xkCapsLock {
+			x.unlockCapsLock()
+		}
+	}
+}
+
+func (x *xkbKeyboard) unlockCapsLock() {
+	body := make([]byte, 12)
+	xgb.Put16(body[0:], xkbUseCoreKbd)
+	body[2] = xp.ModMaskLock // affectModLocks.
+	body[3] = 0              // modLocks.
+	check(x.request(xkbLatchLockState, body, false))
+}
+
+// capsLockLocked returns whether the Lock modifier is locked.
+func (x *xkbKeyboard) capsLockLocked() bool {
+	body := make([]byte, 4)
+	xgb.Put16(body[0:], xkbUseCoreKbd)
+	b, err := x.request(xkbGetState, body, true).Reply()
+	return err == nil && b != nil && b[11]&xp.ModMaskLock != 0
+}
+
+// keyGroup returns the group of the key's keysyms to use for the given group,
+// which may be more than the key has.
+func (key *xkbKey) keyGroup(group int) int {
+	n := int(key.groupInfo & 0x0f)
+	if group < n {
+		return group
+	}
+	switch key.groupInfo & 0xc0 {
+	case xkbClampIntoRange:
+		return n - 1
+	case xkbRedirectIntoRange:
+		if g := int(key.groupInfo>>4) & 0x03; g < n {
+			return g
+		}
+		return 0
+	}
+	return group % n
+}
+
+// lookup returns the keysym of the key for the modifiers and group in a core
+// event's state.
+func (x *xkbKeyboard) lookup(keycode xp.Keycode, state uint16) xp.Keysym {
+	key := &x.keys[keycode]
+	if key.groupInfo&0x0f == 0 || key.width == 0 {
+		return 0
+	}
+	group := key.keyGroup(int(state>>xkbGroupShift) & 0x03)
+	// Key bindings should not depend on Caps Lock, so the Lock modifier is
+	// ignored.
+	mods := byte(state) &^ xp.ModMaskLock
+	level := 0
+	if t := int(key.types[group]); t < len(x.types) {
+		mods &= x.types[t].modsMask
+		for _, e := range x.types[t].entries {
+			if e.mods == mods {
+				level = e.level
+				break
+			}
+		}
+	}
+	if level >= key.width {
+		level = 0
+	}
+	if s := key.syms[group*key.width+level]; s != 0 {
+		return s
+	}
+	return key.syms[group*key.width]
+}
+
+// find returns a keycode and core event state that type the keysym, looking
+// first in the current group and then in the first group.
+func (x *xkbKeyboard) find(keysym xp.Keysym) (keycode xp.Keycode, state uint16) {
+	for _, group := range []int{x.group, 0} {
+		for i := range x.keys {
+			key := &x.keys[i]
+			if key.groupInfo&0x0f == 0 {
+				continue
+			}
+			g := key.keyGroup(group)
+			for level := 0; level < 2 && level < key.width; level++ {
+				if key.syms[g*key.width+level] != keysym {
+					continue
+				}
+				state = uint16(group) << xkbGroupShift
+				if level == 1 {
+					state |= xp.KeyButMaskShift
+				}
+				return xp.Keycode(i), state
+			}
+		}
+	}
+	return 0, 0
+}
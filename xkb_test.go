@@ -0,0 +1,208 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgb"
+	xp "github.com/BurntSushi/xgb/xproto"
+)
+
+const (
+	testKeycodeQ      = 24
+	testKeycode1      = 25
+	testKeycodeReturn = 26
+	testKeycodeEmpty  = 27
+)
+
+// testMapReply returns a GetMap reply, laid out as an X server would send it,
+// for a keyboard with two layouts: US and Russian.
+func testMapReply() []byte {
+	b := make([]byte, 40)
+	b[0] = 1  // A reply.
+	b[15] = 3 // nTypes.
+	b[17] = testKeycodeQ
+	b[20] = 4 // nKeySyms.
+
+	// Key types have an 8 byte header, 8 bytes per entry and, if hasPreserve,
+	// 4 bytes per entry.
+	type entry struct {
+		active      bool
+		mods, level byte
+	}
+	addType := func(modsMask byte, numLevels byte, hasPreserve bool, entries ...entry) {
+		h := make([]byte, 8)
+		h[0] = modsMask
+		h[4] = numLevels
+		h[5] = byte(len(entries))
+		if hasPreserve {
+			h[6] = 1
+		}
+		b = append(b, h...)
+		for _, e := range entries {
+			x := make([]byte, 8)
+			if e.active {
+				x[0] = 1
+			}
+			x[1], x[2] = e.mods, e.level
+			b = append(b, x...)
+		}
+		if hasPreserve {
+			b = append(b, make([]byte, 4*len(entries))...)
+		}
+	}
+	// ONE_LEVEL.
+	addType(0, 1, false)
+	// TWO_LEVEL.
+	addType(xp.ModMaskShift, 2, false, entry{true, xp.ModMaskShift, 1})
+	// ALPHABETIC, with an inactive entry and preserve entries.
+	addType(xp.ModMaskShift|xp.ModMaskLock, 2, true,
+		entry{true, xp.ModMaskShift, 1},
+		entry{false, xp.ModMaskLock, 1},
+	)
+
+	// Keys have an 8 byte header and 4 bytes per keysym.
+	addKey := func(types [4]byte, groupInfo, width byte, syms ...xp.Keysym) {
+		h := make([]byte, 8)
+		copy(h, types[:])
+		h[4], h[5] = groupInfo, width
+		xgb.Put16(h[6:], uint16(len(syms)))
+		b = append(b, h...)
+		for _, s := range syms {
+			x := make([]byte, 4)
+			xgb.Put32(x, uint32(s))
+			b = append(b, x...)
+		}
+	}
+	addKey([4]byte{2, 2}, 2, 2, 'q', 'Q', 0x6ca, 0x6ea)
+	addKey([4]byte{1}, 1, 2, '1', '!')
+	addKey([4]byte{0}, 1, 1, xkReturn)
+	addKey([4]byte{}, 0, 0)
+
+	xgb.Put32(b[4:], uint32(len(b)-32)/4)
+	return b
+}
+
+func testKeyboard(t *testing.T) *xkbKeyboard {
+	types, keys, err := parseMap(testMapReply())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &xkbKeyboard{haveMap: true, types: types, keys: keys}
+}
+
+func TestParseMap(t *testing.T) {
+	x := testKeyboard(t)
+	if len(x.types) != 3 {
+		t.Fatalf("got %d types, want 3", len(x.types))
+	}
+	if got := x.types[2]; got.modsMask != xp.ModMaskShift|xp.ModMaskLock || len(got.entries) != 1 ||
+		got.entries[0] != (xkbKeyTypeEntry{mods: xp.ModMaskShift, level: 1}) {
+		t.Errorf("type #2: got %+v", got)
+	}
+	if got := x.keys[testKeycodeQ]; got.groupInfo != 2 || got.width != 2 || len(got.syms) != 4 || got.syms[3] != 0x6ea {
+		t.Errorf("key Q: got %+v", got)
+	}
+	if got := x.keys[testKeycodeReturn]; got.width != 1 || len(got.syms) != 1 || got.syms[0] != xkReturn {
+		t.Errorf("key Return: got %+v", got)
+	}
+	if got := x.keys[testKeycodeQ-1]; got.groupInfo != 0 || got.syms != nil {
+		t.Errorf("key before the first key: got %+v", got)
+	}
+
+	b := testMapReply()
+	for _, n := range []int{0, 39, 40, 48, len(b) - 1} {
+		if _, _, err := parseMap(b[:n]); err == nil {
+			t.Errorf("truncated to %d bytes: got nil error, want non-nil", n)
+		}
+	}
+}
+
+func TestKeyGroup(t *testing.T) {
+	testCases := []struct {
+		groupInfo byte
+		group     int
+		want      int
+	}{
+		{1, 0, 0},
+		{2, 1, 1},
+		// Groups out of range wrap around by default...
+		{2, 2, 0},
+		{2, 3, 1},
+		{1, 3, 0},
+		// ...or clamp...
+		{xkbClampIntoRange | 2, 3, 1},
+		// ...or redirect to a group, or the first group if that is also
+		// out of range.
+		{xkbRedirectIntoRange | 1<<4 | 2, 3, 1},
+		{xkbRedirectIntoRange | 3<<4 | 2, 3, 0},
+		{xkbRedirectIntoRange | 1<<4 | 2, 1, 1},
+	}
+	for _, tc := range testCases {
+		key := &xkbKey{groupInfo: tc.groupInfo}
+		if got := key.keyGroup(tc.group); got != tc.want {
+			t.Errorf("groupInfo=%#02x, group=%d: got %d, want %d", tc.groupInfo, tc.group, got, tc.want)
+		}
+	}
+}
+
+func TestXkbLookup(t *testing.T) {
+	x := testKeyboard(t)
+	const group1 = 1 << xkbGroupShift
+	testCases := []struct {
+		keycode xp.Keycode
+		state   uint16
+		want    xp.Keysym
+	}{
+		{testKeycodeQ, 0, 'q'},
+		{testKeycodeQ, xp.ModMaskShift, 'Q'},
+		// The Lock modifier is ignored.
+		{testKeycodeQ, xp.ModMaskLock, 'q'},
+		{testKeycodeQ, xp.ModMaskShift | xp.ModMaskLock, 'Q'},
+		// Modifiers not in the key type's mask are ignored.
+		{testKeycodeQ, xp.ModMaskControl | xp.ModMaskShift, 'Q'},
+		{testKeycodeQ, group1, 0x6ca},
+		{testKeycodeQ, group1 | xp.ModMaskShift, 0x6ea},
+		// A key with one group uses it in every group.
+		{testKeycode1, group1, '1'},
+		{testKeycode1, group1 | xp.ModMaskShift, '!'},
+		{testKeycodeReturn, xp.ModMaskShift, xkReturn},
+		{testKeycodeEmpty, 0, 0},
+		{testKeycodeQ - 1, 0, 0},
+	}
+	for _, tc := range testCases {
+		if got := x.lookup(tc.keycode, tc.state); got != tc.want {
+			t.Errorf("lookup(%d, %#04x): got %#x, want %#x", tc.keycode, tc.state, got, tc.want)
+		}
+	}
+}
+
+func TestXkbFind(t *testing.T) {
+	x := testKeyboard(t)
+	const group1 = 1 << xkbGroupShift
+	testCases := []struct {
+		group       int
+		keysym      xp.Keysym
+		wantKeycode xp.Keycode
+		wantState   uint16
+	}{
+		{0, 'q', testKeycodeQ, 0},
+		{0, 'Q', testKeycodeQ, xp.KeyButMaskShift},
+		{0, '!', testKeycode1, xp.KeyButMaskShift},
+		{0, xkReturn, testKeycodeReturn, 0},
+		{0, 0x6ea, 0, 0},
+		{0, 'z', 0, 0},
+		{1, 0x6ea, testKeycodeQ, group1 | xp.KeyButMaskShift},
+		// The current group is searched first...
+		{1, '1', testKeycode1, group1},
+		// ...and then the first group.
+		{1, 'q', testKeycodeQ, 0},
+	}
+	for _, tc := range testCases {
+		x.group = tc.group
+		keycode, state := x.find(tc.keysym)
+		if keycode != tc.wantKeycode || state != tc.wantState {
+			t.Errorf("group %d, find(%#x): got %d, %#04x, want %d, %#04x",
+				tc.group, tc.keysym, keycode, state, tc.wantKeycode, tc.wantState)
+		}
+	}
+}